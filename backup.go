@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxBackupsPerContext is how many backups are kept for each context
+const maxBackupsPerContext = 10
+
+// backupTimeFormat is the timestamp suffix of backup filenames
+const backupTimeFormat = "2006-01-02_15-04-05"
+
+// BackupDir returns the path to ~/.ctx/backups/
+func BackupDir() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "backups"), nil
+}
+
+// backupContext writes a timestamped copy of ctx to ~/.ctx/backups/ and prunes
+// the oldest backups of that context beyond maxBackupsPerContext
+func backupContext(ctx Context) error {
+	data, err := yaml.Marshal(ctx)
+	if err != nil {
+		return err
+	}
+	return backupContextData(ctx.Name, data)
+}
+
+// backupContextData writes data as a timestamped backup of the context name, like
+// backupContext. It takes the file as is, so contexts that don't parse are kept too.
+func backupContextData(name string, data []byte) error {
+	dir, err := BackupDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	// Generate filename: contextname_2025-01-15_14-30-45.yaml, with a _002, _003, ...
+	// counter for further backups within the same second
+	base := sanitizeFilename(name) + "_" + time.Now().Format(backupTimeFormat)
+	path := filepath.Join(dir, base+".yaml")
+	for n := 2; fileExists(path); n++ {
+		path = filepath.Join(dir, fmt.Sprintf("%s_%03d.yaml", base, n))
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+
+	return pruneBackups(name)
+}
+
+// pruneBackups removes the oldest backups of a context beyond maxBackupsPerContext
+func pruneBackups(name string) error {
+	backups, err := ListBackups()
+	if err != nil {
+		return err
+	}
+
+	dir, err := BackupDir()
+	if err != nil {
+		return err
+	}
+
+	// backups is newest first
+	kept := 0
+	for _, b := range backups {
+		if backupContextName(b) != sanitizeFilename(name) {
+			continue
+		}
+		kept++
+		if kept > maxBackupsPerContext {
+			os.Remove(filepath.Join(dir, b+".yaml"))
+		}
+	}
+	return nil
+}
+
+// ListBackups returns the names of all backups (filenames without .yaml), newest first
+func ListBackups() ([]string, error) {
+	dir, err := BackupDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".yaml")
+		if e.IsDir() || name == e.Name() || backupContextName(name) == "" {
+			continue
+		}
+		names = append(names, name)
+	}
+
+	// Sort by timestamp descending (newest first)
+	sort.Slice(names, func(i, j int) bool {
+		return backupTimestamp(names[i]) > backupTimestamp(names[j])
+	})
+
+	return names, nil
+}
+
+// LoadBackup loads the context saved in a backup
+func LoadBackup(name string) (Context, error) {
+	dir, err := BackupDir()
+	if err != nil {
+		return Context{}, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, name+".yaml"))
+	if err != nil {
+		return Context{}, err
+	}
+
+	var ctx Context
+	if err := yaml.Unmarshal(data, &ctx); err != nil {
+		return Context{}, err
+	}
+
+	return ctx, nil
+}
+
+// splitBackupName splits a backup name into the (sanitized) context name and its
+// timestamp suffix, including any same-second counter. ok is false if name isn't
+// a backup.
+func splitBackupName(name string) (context, stamp string, ok bool) {
+	trimmed := name
+	if i := len(name) - 4; i > 0 && name[i] == '_' && strings.Trim(name[i+1:], "0123456789") == "" {
+		trimmed = name[:i] // counter
+	}
+	n := len(trimmed) - len(backupTimeFormat) - 1
+	if n <= 0 || trimmed[n] != '_' {
+		return "", "", false
+	}
+	if _, err := time.Parse(backupTimeFormat, trimmed[n+1:]); err != nil {
+		return "", "", false
+	}
+	return trimmed[:n], name[n+1:], true
+}
+
+// backupContextName returns the (sanitized) context name of a backup, or "" if
+// name isn't a backup
+func backupContextName(name string) string {
+	context, _, _ := splitBackupName(name)
+	return context
+}
+
+// backupTimestamp returns the timestamp suffix of a backup name (with its counter,
+// so same-second backups sort in order)
+func backupTimestamp(name string) string {
+	_, stamp, _ := splitBackupName(name)
+	return stamp
+}
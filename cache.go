@@ -0,0 +1,198 @@
+package main
+
+import (
+	"container/list"
+	"os"
+	"sync"
+	"time"
+)
+
+// maxCacheBytes bounds the total size of file contents held by a fileCache
+const maxCacheBytes = 64 * 1024 * 1024
+
+// fileCache is an in-memory LRU cache of file contents keyed by path. An entry is
+// only used while the file's mtime and size are unchanged.
+type fileCache struct {
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	order    *list.List // front = most recently used
+	size     int64
+	maxBytes int64
+
+	lines map[string]lineCount // countLines results for the Files box
+}
+
+type cacheEntry struct {
+	path    string
+	modTime time.Time
+	size    int64
+	content []byte
+}
+
+// lineCount is a cached line count, used while the file's mtime and size match
+type lineCount struct {
+	modTime time.Time
+	size    int64
+	lines   int
+}
+
+func newFileCache(maxBytes int64) *fileCache {
+	return &fileCache{
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		maxBytes: maxBytes,
+		lines:    make(map[string]lineCount),
+	}
+}
+
+// ReadFile returns the contents of path, from the cache if the file hasn't changed
+func (c *fileCache) ReadFile(path string) ([]byte, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		c.remove(path)
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if el, ok := c.entries[path]; ok {
+		e := el.Value.(*cacheEntry)
+		if e.modTime.Equal(stat.ModTime()) && e.size == stat.Size() {
+			c.order.MoveToFront(el)
+			c.mu.Unlock()
+			return e.content, nil
+		}
+	}
+	c.mu.Unlock()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		c.remove(path)
+		return nil, err
+	}
+
+	c.put(&cacheEntry{path: path, modTime: stat.ModTime(), size: stat.Size(), content: content})
+	return content, nil
+}
+
+// CountLines returns the number of lines in path (see countLines), whose current
+// stat is given. The file is only read again when its mtime or size has changed.
+func (c *fileCache) CountLines(path string, stat os.FileInfo) int {
+	c.mu.Lock()
+	cached, ok := c.lines[path]
+	c.mu.Unlock()
+	if ok && cached.modTime.Equal(stat.ModTime()) && cached.size == stat.Size() {
+		return cached.lines
+	}
+
+	lines := countLines(path)
+	c.mu.Lock()
+	c.lines[path] = lineCount{modTime: stat.ModTime(), size: stat.Size(), lines: lines}
+	c.mu.Unlock()
+	return lines
+}
+
+// ForgetLines drops the cached line count of path
+func (c *fileCache) ForgetLines(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.lines, path)
+}
+
+// Reload drops any cached copy of path and reads it again
+func (c *fileCache) Reload(path string) error {
+	c.remove(path)
+	_, err := c.ReadFile(path)
+	return err
+}
+
+// Clear drops every cached entry
+func (c *fileCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+	c.size = 0
+	clear(c.lines)
+}
+
+func (c *fileCache) put(e *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.removeLocked(e.path)
+
+	// Files larger than the whole cache are never stored
+	if int64(len(e.content)) > c.maxBytes {
+		return
+	}
+
+	c.entries[e.path] = c.order.PushFront(e)
+	c.size += int64(len(e.content))
+
+	// Evict least recently used entries until we're within the limit
+	for c.size > c.maxBytes {
+		oldest := c.order.Back()
+		if oldest == nil {
+			break
+		}
+		c.removeLocked(oldest.Value.(*cacheEntry).path)
+	}
+}
+
+func (c *fileCache) remove(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(path)
+}
+
+func (c *fileCache) removeLocked(path string) {
+	el, ok := c.entries[path]
+	if !ok {
+		return
+	}
+	c.size -= int64(len(el.Value.(*cacheEntry).content))
+	c.order.Remove(el)
+	delete(c.entries, path)
+}
+
+// maxCachedBoxes bounds the number of rendered boxes a boxCache holds
+const maxCachedBoxes = 16
+
+// boxKey identifies a rendered text box by everything that affects its output
+type boxKey struct {
+	title   string
+	content string
+	width   int
+	height  int
+	active  bool
+	wrap    bool
+}
+
+// boxCache holds rendered text boxes so unchanged boxes aren't rebuilt on every
+// redraw. It is shared by all copies of the Model; a nil cache stores nothing.
+type boxCache struct {
+	boxes map[boxKey]string
+}
+
+func newBoxCache() *boxCache {
+	return &boxCache{boxes: make(map[boxKey]string)}
+}
+
+func (c *boxCache) get(key boxKey) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	box, ok := c.boxes[key]
+	return box, ok
+}
+
+func (c *boxCache) put(key boxKey, box string) {
+	if c == nil {
+		return
+	}
+	// Stale sizes and edits pile up; start over rather than tracking use
+	if len(c.boxes) >= maxCachedBoxes {
+		clear(c.boxes)
+	}
+	c.boxes[key] = box
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// contextRef is the context a headless command operates on: a file given with
+// --context-file, else a named context (the active one if no name is given)
+type contextRef struct {
+	Name string
+	File string
+}
+
+// load loads the referenced context
+func (ref contextRef) load(cfg Config) (Context, error) {
+	if ref.File != "" {
+		return LoadContextFromPath(ref.File)
+	}
+	name := ref.Name
+	if name == "" {
+		name = cfg.ActiveContext
+	}
+	ctx, err := LoadContext(name)
+	if err != nil {
+		return Context{}, fmt.Errorf("loading context %q: %w", name, err)
+	}
+	return ctx, nil
+}
+
+// runCLI handles headless command-line flags. It returns true if a headless
+// command was run, in which case the TUI should not be started. Otherwise it
+// returns the --context-file path (if any) for the TUI to open.
+func runCLI(args []string) (bool, string, error) {
+	fs := flag.NewFlagSet("ctx", flag.ExitOnError)
+	contextName := fs.String("context", "", "context to operate on (default: active context)")
+	contextFile := fs.String("context-file", "", "use the context stored in `file` instead of one in ~/.ctx/contexts (changes are saved back to it)")
+	addFromFile := fs.String("add-from-file", "", "add newline-separated paths listed in `file` to the context")
+	initHere := fs.Bool("init-here", false, "create a context from the current directory and make it active")
+	status := fs.Bool("status", false, "print a one-line summary of the context (for shell prompts) and exit")
+	addGitChanges := fs.Bool("add-git-changes", false, "add files with uncommitted git changes in the project root (or current directory)")
+	compact := fs.Bool("compact", false, "remove missing and duplicate files from every saved context and print what was cleaned")
+	var addArgs []string
+	fs.Func("add", "add a file, directory or glob to the context (repeatable; `-` reads newline-separated paths from stdin)", func(v string) error {
+		addArgs = append(addArgs, v)
+		return nil
+	})
+	fs.Parse(args)
+
+	ref := contextRef{Name: *contextName, File: *contextFile}
+
+	if *status {
+		return true, "", cliStatus(ref)
+	}
+
+	if *initHere {
+		if err := EnsureConfigDir(); err != nil {
+			return true, "", err
+		}
+		return true, "", cliInitHere()
+	}
+
+	if *compact {
+		if err := EnsureConfigDir(); err != nil {
+			return true, "", err
+		}
+		return true, "", cliCompact()
+	}
+
+	if *addGitChanges {
+		if err := EnsureConfigDir(); err != nil {
+			return true, "", err
+		}
+		return true, "", cliAddGitChanges(ref)
+	}
+
+	if len(addArgs) == 0 && *addFromFile == "" {
+		return false, *contextFile, nil
+	}
+
+	if err := EnsureConfigDir(); err != nil {
+		return true, "", err
+	}
+
+	// --add and --add-from-file can be combined; the file's paths come last
+	r := addArgsReader(addArgs, os.Stdin)
+	if *addFromFile != "" {
+		f, err := os.Open(*addFromFile)
+		if err != nil {
+			return true, "", err
+		}
+		defer f.Close()
+		r = io.MultiReader(r, f)
+	}
+
+	return true, "", cliAddPaths(ref, r)
+}
+
+// addArgsReader returns the --add arguments as newline-separated paths, with
+// each "-" replaced by the contents of stdin
+func addArgsReader(args []string, stdin io.Reader) io.Reader {
+	var readers []io.Reader
+	for _, arg := range args {
+		if arg == "-" {
+			readers = append(readers, stdin, strings.NewReader("\n"))
+			continue
+		}
+		readers = append(readers, strings.NewReader(arg+"\n"))
+	}
+	return io.MultiReader(readers...)
+}
+
+// cliAddPaths adds each newline-separated path read from r to the context
+// and prints an added/skipped summary
+func cliAddPaths(ref contextRef, r io.Reader) error {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	ctx, err := ref.load(cfg)
+	if err != nil {
+		return err
+	}
+
+	exclude, err := LoadEffectiveExclude(cfg, ctx)
+	if err != nil {
+		return err
+	}
+
+	added, skipped := 0, 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		// Relative paths resolve against the project root, falling back to the
+		// working directory (e.g. output of find)
+		path, ok := resolveInputPath(line, EffectiveProjectRoot(cfg, ctx))
+		if !ok {
+			path = cliAbsPath(line)
+		}
+
+		// Only a path that doesn't exist as written is a glob (app/[id]/page.tsx is a file)
+		if HasGlobMeta(line) && !fileExists(path) {
+			files, err := ExpandGlob(cliAbsPath(line), &exclude)
+			if err != nil || len(files) == 0 {
+				skipped++
+				continue
+			}
+			for _, f := range files {
+				if ctx.AddFile(f) {
+					added++
+				}
+			}
+			continue
+		}
+
+		n, err := ctx.AddPath(path, &exclude, cfg.MaxExpandDepth)
+		if err != nil || n == 0 {
+			skipped++
+			continue
+		}
+		added += n
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if err := SaveContext(ctx); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s: added %d, skipped %d\n", ctx.Name, added, skipped)
+	return nil
+}
+
+// cliAddGitChanges adds the uncommitted git changes in the context's project root
+// (or the working directory) to the context and prints a summary
+func cliAddGitChanges(ref contextRef) error {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	ctx, err := ref.load(cfg)
+	if err != nil {
+		return err
+	}
+
+	exclude, err := LoadEffectiveExclude(cfg, ctx)
+	if err != nil {
+		return err
+	}
+
+	dir := EffectiveProjectRoot(cfg, ctx)
+	if dir == "" {
+		if dir, err = os.Getwd(); err != nil {
+			return err
+		}
+	}
+
+	added, changed, err := ctx.AddGitChanges(dir, &exclude)
+	if err != nil {
+		return err
+	}
+	if err := SaveContext(ctx); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s: %d changed files, added %d\n", ctx.Name, changed, added)
+	return nil
+}
+
+// cliStatus prints the context name, file count, total size and budget usage on one line
+func cliStatus(ref contextRef) error {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	ctx, err := ref.load(cfg)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, f := range ctx.Files {
+		if stat, err := os.Stat(f); err == nil {
+			total += stat.Size()
+		}
+	}
+
+	line := fmt.Sprintf("%s: %d files, %s, ~%s tokens", ctx.Name, len(ctx.Files), formatSize(total), formatTokens(estimateTokens(total)))
+	if cfg.ContextBudgetBytes > 0 {
+		line += fmt.Sprintf(", %d%% of budget", total*100/cfg.ContextBudgetBytes)
+	}
+	fmt.Println(line)
+	return nil
+}
+
+// cliCompact compacts every saved context and prints one line per context
+func cliCompact() error {
+	summaries, err := CompactAllContexts()
+	if err != nil {
+		return err
+	}
+
+	missing, duplicates := 0, 0
+	for _, s := range summaries {
+		fmt.Println(s)
+		missing += s.Missing
+		duplicates += s.Duplicates
+	}
+	fmt.Printf("Removed %d missing and %d duplicate files from %d contexts\n", missing, duplicates, len(summaries))
+	return nil
+}
+
+// cliInitHere creates a context from the working directory and makes it the active context
+func cliInitHere() error {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	ctx, added, err := NewContextFromDir(dir, cfg)
+	if err != nil {
+		return err
+	}
+
+	cfg.ActiveContext = ctx.Name
+	if err := SaveConfig(cfg); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s: created with %d files\n", ctx.Name, added)
+	return nil
+}
+
+// cliAbsPath expands ~ and environment variables in path and makes it absolute
+// relative to the working directory
+func cliAbsPath(path string) string {
+	path = expandPath(path)
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// shellCommand returns a ctx invocation that adds the context's files, like
+// "ctx --context foo --add a.go --add b.go". With a project root, files inside it
+// are given relative to it and the command starts by changing into it.
+func shellCommand(ctx Context, root string) string {
+	var parts []string
+	if root != "" {
+		parts = append(parts, "cd", shellPath(root), "&&")
+	}
+
+	parts = append(parts, "ctx")
+	if ctx.SourcePath != "" {
+		parts = append(parts, "--context-file", shellPath(ctx.SourcePath))
+	} else {
+		parts = append(parts, "--context", shellQuote(ctx.Name))
+	}
+
+	for _, path := range ctx.Files {
+		arg := shellPath(path)
+		if root != "" {
+			if rel, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(rel, "..") {
+				arg = shellQuote(rel)
+			}
+		}
+		parts = append(parts, "--add", arg)
+	}
+	return strings.Join(parts, " ")
+}
+
+// shellPath quotes an absolute path for a shell, keeping a leading ~/ for the
+// home directory unquoted so it still expands
+func shellPath(path string) string {
+	home, err := os.UserHomeDir()
+	if err == nil && strings.HasPrefix(path, home+"/") {
+		return "~/" + shellQuote(strings.TrimPrefix(path, home+"/"))
+	}
+	return shellQuote(path)
+}
+
+// shellQuote single-quotes s unless it consists only of characters that are safe
+// unquoted in a POSIX shell
+func shellQuote(s string) string {
+	safe := s != ""
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("_-./+=:,@%", r)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -1,89 +1,134 @@
 package main
 
 import (
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
 	"os/exec"
 
 	"github.com/atotto/clipboard"
 )
 
+// ErrClipboardVerify is returned when the clipboard doesn't contain what was written
+var ErrClipboardVerify = errors.New("clipboard verification failed")
+
 // CopyToClipboard copies text to the system clipboard
-// It tries atotto/clipboard first, then falls back to platform-specific tools
-func CopyToClipboard(text string) error {
+// It tries atotto/clipboard first, then falls back to platform-specific tools.
+// When verify is true, the clipboard is read back after writing and a mismatch
+// falls through to the fallbacks (returning ErrClipboardVerify if none succeed).
+func CopyToClipboard(text string, verify bool) error {
 	// Try atotto/clipboard first
 	err := clipboard.WriteAll(text)
 	if err == nil {
-		return nil
-	}
-
-	// Fallback to pbcopy (macOS)
-	if pbcopyPath, err := exec.LookPath("pbcopy"); err == nil {
-		cmd := exec.Command(pbcopyPath)
-		stdin, err := cmd.StdinPipe()
-		if err != nil {
-			return err
+		if !verify || clipboardMatches(text) {
+			return nil
 		}
+		err = ErrClipboardVerify
+	}
 
-		if err := cmd.Start(); err != nil {
-			return err
-		}
+	// Fall back to the platform tools, or return the original error if there are none
+	if toolErr := copyWithTools(text, verify); !errors.Is(toolErr, errNoClipboardTool) {
+		return toolErr
+	}
+	return err
+}
 
-		if _, err := stdin.Write([]byte(text)); err != nil {
-			return err
-		}
+// CopyToClipboardToolsFirst copies text with the platform tools and only falls
+// back to atotto/clipboard if none is installed. Used to copy error details,
+// when atotto itself may be what failed.
+func CopyToClipboardToolsFirst(text string) error {
+	err := copyWithTools(text, false)
+	if errors.Is(err, errNoClipboardTool) {
+		return clipboard.WriteAll(text)
+	}
+	return err
+}
 
-		if err := stdin.Close(); err != nil {
-			return err
-		}
+// errNoClipboardTool is returned by copyWithTools when no clipboard tool is installed
+var errNoClipboardTool = errors.New("no clipboard tool found (pbcopy, xclip or xsel)")
 
-		return cmd.Wait()
+// copyWithTools copies text with the first clipboard tool found on the PATH
+func copyWithTools(text string, verify bool) error {
+	// pbcopy (macOS)
+	if pbcopyPath, err := exec.LookPath("pbcopy"); err == nil {
+		return verifyWrite(writeToTool(text, pbcopyPath), text, verify)
 	}
 
-	// Fallback to xclip (Linux)
+	// xclip (Linux)
 	if xclipPath, err := exec.LookPath("xclip"); err == nil {
-		cmd := exec.Command(xclipPath, "-selection", "clipboard")
-		stdin, err := cmd.StdinPipe()
-		if err != nil {
-			return err
-		}
+		return verifyWrite(writeToTool(text, xclipPath, "-selection", "clipboard"), text, verify)
+	}
 
-		if err := cmd.Start(); err != nil {
-			return err
-		}
+	// xsel (Linux)
+	if xselPath, err := exec.LookPath("xsel"); err == nil {
+		return verifyWrite(writeToTool(text, xselPath, "--clipboard", "--input"), text, verify)
+	}
 
-		if _, err := stdin.Write([]byte(text)); err != nil {
-			return err
-		}
+	return errNoClipboardTool
+}
 
-		if err := stdin.Close(); err != nil {
-			return err
-		}
+// writeToTool runs a clipboard tool with text piped to its stdin. If that fails
+// (large payloads can break the pipe on some systems), it retries with stdin
+// redirected from a temp file, which is removed afterwards.
+func writeToTool(text string, path string, args ...string) error {
+	cmd := exec.Command(path, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
 
-		return cmd.Wait()
+	if err := cmd.Start(); err != nil {
+		return err
 	}
 
-	// Fallback to xsel (Linux)
-	if xselPath, err := exec.LookPath("xsel"); err == nil {
-		cmd := exec.Command(xselPath, "--clipboard", "--input")
-		stdin, err := cmd.StdinPipe()
-		if err != nil {
-			return err
-		}
+	_, writeErr := stdin.Write([]byte(text))
+	closeErr := stdin.Close()
+	waitErr := cmd.Wait()
+	if writeErr == nil && closeErr == nil && waitErr == nil {
+		return nil
+	}
 
-		if err := cmd.Start(); err != nil {
-			return err
-		}
+	return writeToToolViaFile(text, path, args...)
+}
 
-		if _, err := stdin.Write([]byte(text)); err != nil {
-			return err
-		}
+// writeToToolViaFile runs a clipboard tool with stdin redirected from a temp file holding text
+func writeToToolViaFile(text string, path string, args ...string) error {
+	f, err := os.CreateTemp("", "ctx-clipboard-*.txt")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
 
-		if err := stdin.Close(); err != nil {
-			return err
-		}
+	if _, err := f.WriteString(text); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = f
+	return cmd.Run()
+}
 
-		return cmd.Wait()
+// verifyWrite checks the clipboard after a fallback write completed without error
+func verifyWrite(err error, text string, verify bool) error {
+	if err != nil || !verify {
+		return err
+	}
+	if !clipboardMatches(text) {
+		return ErrClipboardVerify
 	}
+	return nil
+}
 
-	// Return original error if no fallback worked
-	return err
+// clipboardMatches reads the clipboard back and compares it with text
+func clipboardMatches(text string) bool {
+	got, err := clipboard.ReadAll()
+	if err != nil {
+		return false
+	}
+	return len(got) == len(text) && sha256.Sum256([]byte(got)) == sha256.Sum256([]byte(text))
 }
@@ -0,0 +1,480 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// command is an action that can be run from the command palette
+type command struct {
+	Name string // e.g. "delete context"
+	Key  string // equivalent keybinding, shown as a hint
+	Run  func(m Model) (tea.Model, tea.Cmd)
+}
+
+// helpSection lists the keybindings of one mode for the help overlay
+type helpSection struct {
+	Mode     mode
+	Tab      mainTab // only meaningful for modeNormal
+	Title    string
+	Bindings [][2]string // key, description
+}
+
+// paletteCommands returns every action available from the command palette
+func paletteCommands() []command {
+	return []command{
+		{"yank to clipboard", "y", pressKey("y")},
+		{"yank and quit", "Y", pressKey("Y")},
+		{"add file or directory", "a", pressKey("a")},
+		{"delete selected files", "d", pressKey("d")},
+		{"clear all files", "D", pressKey("D")},
+		{"remove missing files", "M", pressKey("M")},
+		{"remove duplicate files", "", runRemoveDuplicates},
+		{"compact all contexts", "", runCompactAll},
+		{"add directories from list file", "", runAddDirList},
+		{"add git changes", "", runAddGitChanges},
+		{"export history", "", runExportHistory},
+		{"export prompt to markdown", "", runExportMarkdown},
+		{"audit contexts", "", Model.openAudit},
+		{"select all files", "*", pressKey("*")},
+		{"select missing files", "m", pressKey("m")},
+		{"show missing files only", "!", pressKey("!")},
+		{"clear selection", "u", pressKey("u")},
+		{"yank cursor file only", "F", pressKey("F")},
+		{"copy file path", "p", pressKey("p")},
+		{"copy file list as ctx command", "$", pressKey("$")},
+		{"copy last error details", "ctrl+e", runCopyLastError},
+		{"pin/unpin file", "P", pressKey("P")},
+		{"disable/enable file", "x", pressKey("x")},
+		{"reload cursor file", "ctrl+r", runReloadCursorFile},
+		{"full preview", "v", pressKey("v")},
+		{"copy preview text", "V", pressKey("V")},
+		{"copy project context and request only", "ctrl+y", runCopyInstructions},
+		{"edit file note", "n", pressKey("n")},
+		{"cycle sort mode", "o", pressKey("o")},
+		{"move file down", "J", pressKey("J")},
+		{"move file up", "K", pressKey("K")},
+		{"folder view", "f", pressKey("f")},
+		{"edit request", "", editBox(boxRequest)},
+		{"swap request and project context", "S", pressKey("S")},
+		{"edit project context", "", editBox(boxProjectContext)},
+		{"project context from file", "", runContextFromFile},
+		{"sync project context from file", "", runSyncProjectContext},
+		{"toggle word wrap", "w", pressKey("w")},
+		{"switch context", "c", pressKey("c")},
+		{"new context", "", runNewContext},
+		{"new context from current dir", "N", pressKey("N")},
+		{"delete context", "", runDeleteContext},
+		{"restore context backup", "", Model.enterBackupSelect},
+		{"next context", "}", pressKey("}")},
+		{"previous context", "{", pressKey("{")},
+		{"back to last context", "ctrl+o", runContextBack},
+		{"switch exclude rule", "E", pressKey("E")},
+		{"test exclude rule", "T", pressKey("T")},
+		{"set project root", "R", pressKey("R")},
+		{"exclude cursor file extension", "X", pressKey("X")},
+		{"reload from disk", "r", pressKey("r")},
+		{"show config", "s", pressKey("s")},
+		{"edit skip prefixes", "", Model.openSkipPrefixes},
+		{"open config directory", "", runOpenConfigDir},
+		{"reset exclude rule to defaults", "", runResetExclude},
+		{"show stats", "i", pressKey("i")},
+		{"history tab", ">", pressKey(">")},
+		{"context tab", "<", pressKey("<")},
+		{"help", "?", pressKey("?")},
+		{"quit", "q", pressKey("q")},
+	}
+}
+
+// helpSections returns the keybinding reference for every mode the help overlay can open from
+func helpSections() []helpSection {
+	return []helpSection{
+		{modeNormal, tabContext, "Context Tab", [][2]string{
+			{"< / >", "switch between Context and History tabs"},
+			{"y", "yank to clipboard (also saves to history)"},
+			{"Y", "yank, then quit once the copy succeeds"},
+			{"d", "delete selected/cursor file"},
+			{"D", "clear all files"},
+			{"M", "remove all missing files"},
+			{"*", "select/deselect all"},
+			{"m", "select all missing files"},
+			{"!", "show only missing files (again for all)"},
+			{"u", "clear all selections"},
+			{"space", "toggle file selection"},
+			{"a", "add file/directory/glob"},
+			{"F", "yank only the cursor file, wrapped in its <file> tag"},
+			{"p", "copy path of cursor file"},
+			{"P", "pin/unpin the cursor file (pinned files are listed and yanked first)"},
+			{"x", "disable/enable the cursor file (kept in the list, left out of yanks)"},
+			{"ctrl+r", "reload only the cursor file"},
+			{"ctrl+e", "copy the full text of the last error"},
+			{"v", "scroll through the full prompt"},
+			{"V", "copy the preview box text (not the full prompt)"},
+			{"ctrl+y", "copy the project context and request without files (not saved to history)"},
+			{"$", "copy a ctx --add command that rebuilds the file list"},
+			{"n", "edit the cursor file's note"},
+			{"o", "cycle sort mode (size/name/custom)"},
+			{"J / K", "move cursor file down/up (custom sort)"},
+			{"f", "toggle folder view"},
+			{"w", "toggle word-wrap"},
+			{"S", "swap Request and Project Context"},
+			{"e / enter", "edit active box (Request, Project Context, or the cursor file's path in Files)"},
+			{"tab / shift+tab", "switch between boxes"},
+			{"{ / }", "switch between contexts"},
+			{"1-9", "jump to a favorite context (outside the Files box)"},
+			{"ctrl+o", "back to the previously active context"},
+			{"c", "open context selection menu"},
+			{"N", "new context from current directory"},
+			{"E", "switch exclude rule"},
+			{"R", "set project root"},
+			{"T", "test exclude rule on a directory"},
+			{"X", "exclude the cursor file's extension (**/*.ext) and remove matching files"},
+			{"r", "reload from disk"},
+			{"s", "show current config (e there edits skip prefixes, o opens the config dir)"},
+			{"i", "show stats (lines and size by language)"},
+			{"↑/↓ or j/k", "navigate files"},
+			{"<n> enter", "jump to file number n (Files box active)"},
+			{":", "command palette"},
+			{"?", "help"},
+			{"q", "quit"},
+		}},
+		{modeNormal, tabHistory, "History Tab", [][2]string{
+			{"< / >", "switch between Context and History tabs"},
+			{"↑/↓ or j/k", "navigate entries"},
+			{"y", "yank selected entry"},
+			{"P", "pin/unpin entry (pinned entries are never pruned)"},
+			{"o", "toggle newest/oldest first"},
+			{"space", "mark entry as diff base"},
+			{"=", "diff base against selected entry"},
+			{":", "command palette"},
+			{"?", "help"},
+			{"q", "quit"},
+		}},
+		{modeContextSelect, 0, "Context Selection", [][2]string{
+			{"type", "fuzzy-filter contexts (backspace deletes)"},
+			{"↑/↓", "navigate"},
+			{"enter", "select context ([+] New context starts from the typed text)"},
+			{"space", "mark context for batch delete"},
+			{"ctrl+f", "add/remove the cursor context as a favorite (1-9 jump to favorites)"},
+			{"ctrl+l", "list all contexts by total size"},
+			{"ctrl+a", "merge files of context into the active one"},
+			{"ctrl+t", "merge files, project context and request into the active one"},
+			{"ctrl+d", "delete marked contexts, or the cursor context (not allowed for default)"},
+			{"?", "help"},
+			{"esc", "cancel"},
+		}},
+		{modeExcludeSelect, 0, "Exclude Rule Selection", [][2]string{
+			{"type", "fuzzy-filter exclude rules (backspace deletes)"},
+			{"↑/↓", "navigate"},
+			{"enter", "select exclude rule"},
+			{"ctrl+r", "reset the cursor rule's patterns to the defaults (after confirmation)"},
+			{"?", "help"},
+			{"esc", "cancel"},
+		}},
+		{modeTemplateSelect, 0, "Template Selection", [][2]string{
+			{"↑/↓ or j/k", "navigate"},
+			{"enter", "create the context from the template ((blank) for an empty one)"},
+			{"?", "help"},
+			{"esc", "cancel"},
+		}},
+		{modeFolderView, 0, "Folder View", [][2]string{
+			{"↑/↓ or j/k", "navigate folders"},
+			{"d", "delete files in selected folders"},
+			{"x", "add <folder>/** to the exclude rule and remove its files"},
+			{"space", "toggle folder selection"},
+			{"f / esc", "back to file view"},
+			{"?", "help"},
+			{"q", "quit"},
+		}},
+		{modeFullPreview, 0, "Full Preview", [][2]string{
+			{"↑/↓ or j/k", "scroll"},
+			{"pgup/pgdn or b/space", "page up/down"},
+			{"g / G", "top / bottom"},
+			{"esc / q / v", "back"},
+			{"?", "help"},
+		}},
+		{modeAudit, 0, "Context Audit", [][2]string{
+			{"↑/↓ or j/k", "scroll"},
+			{"esc / q", "back"},
+			{"?", "help"},
+		}},
+		{modeHistoryDiff, 0, "History Diff", [][2]string{
+			{"↑/↓ or j/k", "scroll"},
+			{"esc / q / =", "back to history"},
+			{"?", "help"},
+		}},
+	}
+}
+
+// currentHelpSection returns the help section for the mode the overlay was opened from
+func (m Model) currentHelpSection() helpSection {
+	for _, section := range helpSections() {
+		if section.Mode == m.helpReturnMode && (section.Mode != modeNormal || section.Tab == m.activeTab) {
+			return section
+		}
+	}
+	return helpSection{Title: "Keybindings"}
+}
+
+// openHelp shows the help overlay for the current mode
+func (m Model) openHelp() (tea.Model, tea.Cmd) {
+	m.helpReturnMode = m.mode
+	m.mode = modeHelp
+	return m, nil
+}
+
+// pressKey returns a command that behaves like pressing key in the main view
+func pressKey(key string) func(m Model) (tea.Model, tea.Cmd) {
+	return func(m Model) (tea.Model, tea.Cmd) {
+		return m.handleNormalKey(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)})
+	}
+}
+
+// editBox returns a command that opens the editor for a text box
+func editBox(box int) func(m Model) (tea.Model, tea.Cmd) {
+	return func(m Model) (tea.Model, tea.Cmd) {
+		m.activeTab = tabContext
+		m.activeBox = box
+		return m.enterEditMode()
+	}
+}
+
+func runNewContext(m Model) (tea.Model, tea.Cmd) {
+	m.mode = modeNewContext
+	m.inputBuffer = ""
+	return m, nil
+}
+
+func runContextFromFile(m Model) (tea.Model, tea.Cmd) {
+	m.mode = modeContextFromFile
+	m.inputBuffer = ""
+	if m.context.ProjectContextFile != "" {
+		m.inputBuffer = m.context.ProjectContextFile
+		if m.context.ProjectContextSection != "" {
+			m.inputBuffer += "#" + m.context.ProjectContextSection
+		}
+	}
+	return m, nil
+}
+
+func runAddDirList(m Model) (tea.Model, tea.Cmd) {
+	m.mode = modeAddDirList
+	m.inputBuffer = ""
+	return m, nil
+}
+
+func runAddGitChanges(m Model) (tea.Model, tea.Cmd) {
+	return m, m.addGitChanges()
+}
+
+func runExportHistory(m Model) (tea.Model, tea.Cmd) {
+	m.mode = modeExportHistory
+	m.inputBuffer = ""
+	return m, nil
+}
+
+func runExportMarkdown(m Model) (tea.Model, tea.Cmd) {
+	return m, m.exportMarkdown()
+}
+
+func runSyncProjectContext(m Model) (tea.Model, tea.Cmd) {
+	return m, m.syncProjectContext()
+}
+
+func runReloadCursorFile(m Model) (tea.Model, tea.Cmd) {
+	return m, m.reloadCursorFile()
+}
+
+func runResetExclude(m Model) (tea.Model, tea.Cmd) {
+	m.resetActiveExclude()
+	return m, nil
+}
+
+func runCopyInstructions(m Model) (tea.Model, tea.Cmd) {
+	return m, m.copyInstructions()
+}
+
+func runOpenConfigDir(m Model) (tea.Model, tea.Cmd) {
+	return m, m.openConfigDir()
+}
+
+func runCopyLastError(m Model) (tea.Model, tea.Cmd) {
+	return m, m.copyLastError()
+}
+
+func runContextBack(m Model) (tea.Model, tea.Cmd) {
+	return m, m.contextBack()
+}
+
+func runCompactAll(m Model) (tea.Model, tea.Cmd) {
+	return m, m.compactAllContexts()
+}
+
+func runRemoveDuplicates(m Model) (tea.Model, tea.Cmd) {
+	return m, m.removeDuplicates()
+}
+
+func runDeleteContext(m Model) (tea.Model, tea.Cmd) {
+	if m.context.Name == "default" {
+		return m, m.setStatus("Cannot delete the default context")
+	}
+	// The stored context of the same name is unrelated to the opened file
+	if m.context.SourcePath != "" {
+		return m, m.setStatus("Context opened from " + m.showPath(m.context.SourcePath) + "; delete the file itself")
+	}
+	m.confirmDeleteContext(m.context.Name, modeNormal)
+	return m, nil
+}
+
+// filterCommands returns the commands whose name fuzzy-matches query
+func filterCommands(commands []command, query string) []command {
+	var matched []command
+	for _, c := range commands {
+		if fuzzyMatch(c.Name, query) {
+			matched = append(matched, c)
+		}
+	}
+	return matched
+}
+
+// fuzzyMatch reports whether all characters of query appear in s in order (case-insensitive)
+func fuzzyMatch(s, query string) bool {
+	s = strings.ToLower(s)
+	for _, r := range strings.ToLower(query) {
+		if r == ' ' {
+			continue
+		}
+		idx := strings.IndexRune(s, r)
+		if idx < 0 {
+			return false
+		}
+		s = s[idx+len(string(r)):]
+	}
+	return true
+}
+
+func (m Model) enterCommandPalette() (tea.Model, tea.Cmd) {
+	m.inputBuffer = ""
+	m.selectCursor = 0
+	m.mode = modeCommand
+	return m, nil
+}
+
+func (m Model) handleCommandKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	matches := filterCommands(paletteCommands(), m.inputBuffer)
+
+	switch msg.Type {
+	case tea.KeyEsc, tea.KeyCtrlC:
+		m.mode = modeNormal
+		return m, nil
+
+	case tea.KeyEnter:
+		m.mode = modeNormal
+		if m.selectCursor < len(matches) {
+			return matches[m.selectCursor].Run(m)
+		}
+		return m, nil
+
+	case tea.KeyUp:
+		if m.selectCursor > 0 {
+			m.selectCursor--
+		}
+
+	case tea.KeyDown:
+		if m.selectCursor < len(matches)-1 {
+			m.selectCursor++
+		}
+
+	case tea.KeyBackspace:
+		if len(m.inputBuffer) > 0 {
+			m.inputBuffer = m.inputBuffer[:len(m.inputBuffer)-1]
+			m.selectCursor = 0
+		}
+
+	case tea.KeyRunes, tea.KeySpace:
+		m.inputBuffer += string(msg.Runes)
+		m.selectCursor = 0
+	}
+
+	return m, nil
+}
+
+func (m Model) handleHelpKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	// Any key closes the overlay
+	m.mode = m.helpReturnMode
+	return m, nil
+}
+
+func (m Model) viewCommandPalette() string {
+	var sb strings.Builder
+
+	sb.WriteString(titleStyle.Render("Command Palette"))
+	sb.WriteString("\n")
+	sb.WriteString(strings.Repeat("─", min(m.width, 40)))
+	sb.WriteString("\n")
+	sb.WriteString(": ")
+	sb.WriteString(m.inputBuffer)
+	sb.WriteString("_\n\n")
+
+	matches := filterCommands(paletteCommands(), m.inputBuffer)
+	if len(matches) == 0 {
+		sb.WriteString(dimStyle.Render("  (no matching commands)"))
+		sb.WriteString("\n")
+	}
+
+	visibleRows := m.visibleFileRows() - 3
+	start := 0
+	if m.selectCursor >= visibleRows {
+		start = m.selectCursor - visibleRows + 1
+	}
+	for i := start; i < len(matches) && i < start+visibleRows; i++ {
+		c := matches[i]
+		prefix := "  "
+		if i == m.selectCursor {
+			prefix = "> "
+		}
+
+		line := fmt.Sprintf("%s%-28s", prefix, c.Name)
+		if i == m.selectCursor {
+			line = cursorStyle.Render(line)
+		}
+		sb.WriteString(line)
+		if c.Key != "" {
+			sb.WriteString(dimStyle.Render(c.Key))
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString(strings.Repeat("─", min(m.width, 40)))
+	sb.WriteString("\n")
+	sb.WriteString(dimStyle.Render("[enter] run  [↑/↓] navigate  [esc] cancel"))
+	sb.WriteString("\n")
+
+	return sb.String()
+}
+
+func (m Model) viewHelp() string {
+	section := m.currentHelpSection()
+
+	var content strings.Builder
+	content.WriteString(titleStyle.Render(section.Title + " Keybindings"))
+	content.WriteString("\n\n")
+	for _, b := range section.Bindings {
+		content.WriteString(cursorStyle.Render(fmt.Sprintf("%-18s", b[0])))
+		content.WriteString(" ")
+		content.WriteString(b[1])
+		content.WriteString("\n")
+	}
+	content.WriteString("\n")
+	content.WriteString(dimStyle.Render("[any key] close"))
+
+	box := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color("14")).
+		Padding(0, 1)
+
+	return box.Render(content.String())
+}
@@ -1,30 +1,94 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
 
 	"gopkg.in/yaml.v3"
 )
 
 // Config represents the main config file (~/.ctx/config.yaml)
 type Config struct {
-	ActiveContext string   `yaml:"active_context"`
-	ActiveExclude string   `yaml:"active_exclude"`
-	SkipPrefixes  []string `yaml:"skip_prefixes"`
+	ActiveContext      string   `yaml:"active_context"`
+	ActiveExclude      string   `yaml:"active_exclude"`
+	SkipPrefixes       []string `yaml:"skip_prefixes"`
+	CompressHistory    bool     `yaml:"compress_history,omitempty"`     // write history entries as .yaml.gz
+	VerifyClipboard    bool     `yaml:"verify_clipboard,omitempty"`     // read the clipboard back after copying
+	WrapText           bool     `yaml:"wrap_text,omitempty"`            // soft-wrap long lines in boxes and preview
+	WrapNavigation     bool     `yaml:"wrap_navigation,omitempty"`      // j/k wrap around at the ends of the file, folder and history lists
+	RestoreSession     bool     `yaml:"restore_session,omitempty"`      // restore tab/cursor/box from session.yaml on launch
+	ContextBudgetBytes int64    `yaml:"context_budget_bytes,omitempty"` // yank asks for confirmation above this size (negative disables)
+	IncludeTree        bool     `yaml:"include_tree,omitempty"`         // add a <file_tree> overview to the prompt
+	IncludeFileMeta    bool     `yaml:"include_file_meta,omitempty"`    // add size and modified attributes to each <file> tag
+	IncludeGitDiff     bool     `yaml:"include_git_diff,omitempty"`     // append uncommitted changes as a <git_diff> section
+	IncludeManifest    bool     `yaml:"include_manifest,omitempty"`     // end the prompt with a <manifest> of paths and content hashes
+	EscapeFileContents bool     `yaml:"escape_file_contents,omitempty"` // wrap file contents in CDATA
+	OutputFormat       string   `yaml:"output_format,omitempty"`        // "xml" (default) or "json"
+	SortMode           string   `yaml:"sort_mode,omitempty"`            // file list order: "size" (default), "name" or "custom"
+	FavoriteContexts   []string `yaml:"favorite_contexts,omitempty"`    // contexts jumped to with 1-9, in order
+	StripComments      bool     `yaml:"strip_comments,omitempty"`       // trim trailing whitespace and drop comment-only lines when yanking
+	TrimBlankLines     bool     `yaml:"trim_blank_lines,omitempty"`     // drop leading/trailing blank lines and collapse blank runs when yanking
+	LineNumbers        bool     `yaml:"line_numbers,omitempty"`         // prefix each line of file contents with its line number
+	Preamble           string   `yaml:"preamble,omitempty"`             // replaces the built-in prompt preamble
+	FileIcons          bool     `yaml:"file_icons,omitempty"`           // show Nerd Font icons instead of ASCII type tags
+	FullPaths          bool     `yaml:"full_paths,omitempty"`           // display paths in full instead of collapsing the home directory to ~
+	IncludeHidden      bool     `yaml:"include_hidden,omitempty"`       // descend into dotfiles and dot-directories when expanding directories
+	IncludeConfigDir   bool     `yaml:"include_config_dir,omitempty"`   // let directory expansion enter ~/.ctx (for debugging)
+	MaxExpandDepth     int      `yaml:"max_expand_depth,omitempty"`     // directory expansion stops this many levels down (0 = unlimited)
+	SyntaxHighlight    bool     `yaml:"syntax_highlight,omitempty"`     // highlight file contents in the full preview
+
+	// Preview shows only the first/last lines of a request longer than their sum (0 and 0 = whole request)
+	PreviewRequestHead int `yaml:"preview_request_head,omitempty"`
+	PreviewRequestTail int `yaml:"preview_request_tail,omitempty"`
+
+	HistoryFormat       string `yaml:"history_format,omitempty"`        // "yaml-files" (default) or "jsonl"
+	HistoryTimeFormat   string `yaml:"history_time_format,omitempty"`   // Go time layout for history timestamps
+	HistoryRelativeTime bool   `yaml:"history_relative_time,omitempty"` // show history timestamps as "3d ago"
+
+	// Set from a project-local .ctx.yaml, never saved to the global config
+	ProjectRoot   string         `yaml:"-"` // default project root for contexts without one
+	ProjectConfig string         `yaml:"-"` // path of the .ctx.yaml that was applied
+	project       *ProjectConfig // overlaid values
+	global        *Config        // global values of overlaid fields, restored on save
+}
+
+// projectConfigName is the filename of a project-local config
+const projectConfigName = ".ctx.yaml"
+
+// ProjectConfig is a project-local .ctx.yaml that overlays the global config
+type ProjectConfig struct {
+	ActiveExclude string   `yaml:"active_exclude,omitempty"`
+	SkipPrefixes  []string `yaml:"skip_prefixes,omitempty"`
+	ProjectRoot   string   `yaml:"project_root,omitempty"` // relative paths are resolved against the file's directory
+	Preamble      string   `yaml:"preamble,omitempty"`
 }
 
 // DefaultConfig returns a config with sensible defaults
 func DefaultConfig() Config {
 	return Config{
-		ActiveContext: "default",
-		ActiveExclude: "default",
-		SkipPrefixes:  []string{"work", "projects", "code", "dev", "repos"},
+		ActiveContext:      "default",
+		ActiveExclude:      "default",
+		SkipPrefixes:       []string{"work", "projects", "code", "dev", "repos"},
+		ContextBudgetBytes: 600 * 1024,
 	}
 }
 
-// ConfigDir returns the path to ~/.ctx/
+// configDirEnv names the environment variable that overrides ~/.ctx/
+const configDirEnv = "CTX_HOME"
+
+// ConfigDir returns the path to ~/.ctx/, or to $CTX_HOME if it is set (for
+// tests, sandboxes or separate profiles)
 func ConfigDir() (string, error) {
+	if dir := os.Getenv(configDirEnv); dir != "" {
+		return filepath.Abs(expandPath(dir))
+	}
+
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
@@ -32,6 +96,20 @@ func ConfigDir() (string, error) {
 	return filepath.Join(home, ".ctx"), nil
 }
 
+// openCommand returns a command that opens path with the platform's opener
+// (open on macOS, xdg-open elsewhere), or an error if it isn't installed
+func openCommand(path string) (*exec.Cmd, error) {
+	name := "xdg-open"
+	if runtime.GOOS == "darwin" {
+		name = "open"
+	}
+	bin, err := exec.LookPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s not found", name)
+	}
+	return exec.Command(bin, path), nil
+}
+
 // EnsureConfigDir creates ~/.ctx/ and subdirectories if they don't exist
 func EnsureConfigDir() error {
 	dir, err := ConfigDir()
@@ -52,6 +130,11 @@ func EnsureConfigDir() error {
 		}
 	}
 
+	// Create the templates directory with example templates on first run
+	if err := ensureTemplateDir(); err != nil {
+		return err
+	}
+
 	// Create default config if it doesn't exist
 	configPath := filepath.Join(dir, "config.yaml")
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
@@ -79,17 +162,8 @@ func EnsureConfigDir() error {
 	defaultExcludePath := filepath.Join(dir, "excludes", "default.yaml")
 	if _, err := os.Stat(defaultExcludePath); os.IsNotExist(err) {
 		exc := ExcludeRule{
-			Name: "default",
-			Patterns: []string{
-				"**/node_modules/**",
-				"**/.git/**",
-				"**/.env",
-				"**/.env.*",
-				"**/*.env",
-				"**/package-lock.json",
-				"**/pnpm-lock.yaml",
-				"**/yarn.lock",
-			},
+			Name:     "default",
+			Patterns: DefaultExcludePatterns(),
 		}
 		if err := SaveExcludeRule(exc); err != nil {
 			return err
@@ -106,13 +180,14 @@ func LoadConfig() (Config, error) {
 		return Config{}, err
 	}
 
-	data, err := os.ReadFile(filepath.Join(dir, "config.yaml"))
+	path := filepath.Join(dir, "config.yaml")
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return Config{}, err
 	}
 
 	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	if err := unmarshalStrict(path, data, &cfg); err != nil {
 		return Config{}, err
 	}
 
@@ -121,9 +196,93 @@ func LoadConfig() (Config, error) {
 		cfg.SkipPrefixes = DefaultConfig().SkipPrefixes
 	}
 
+	// Ensure context_budget_bytes has a default if unset
+	if cfg.ContextBudgetBytes == 0 {
+		cfg.ContextBudgetBytes = DefaultConfig().ContextBudgetBytes
+	}
+
+	// Overlay the project-local config, if any
+	if path := findProjectConfig(); path != "" {
+		if err := cfg.applyProjectConfig(path); err != nil {
+			return Config{}, err
+		}
+	}
+
 	return cfg, nil
 }
 
+// unmarshalStrict decodes YAML like yaml.Unmarshal, but rejects keys that don't
+// match a field and reports the file, so a typo'd key isn't silently ignored.
+// An empty document decodes to the zero value.
+func unmarshalStrict(path string, data []byte, v any) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// findProjectConfig looks for a .ctx.yaml in the working directory and its parents,
+// stopping at the repository root (a directory containing .git). Returns "" if none.
+func findProjectConfig() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+
+	for {
+		path := filepath.Join(dir, projectConfigName)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// applyProjectConfig overlays the project config at path; its values take precedence
+func (cfg *Config) applyProjectConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var proj ProjectConfig
+	if err := unmarshalStrict(path, data, &proj); err != nil {
+		return err
+	}
+
+	global := *cfg
+	cfg.global = &global
+	cfg.project = &proj
+	cfg.ProjectConfig = path
+
+	if proj.ActiveExclude != "" {
+		cfg.ActiveExclude = proj.ActiveExclude
+	}
+	if len(proj.SkipPrefixes) > 0 {
+		cfg.SkipPrefixes = proj.SkipPrefixes
+	}
+	if proj.Preamble != "" {
+		cfg.Preamble = proj.Preamble
+	}
+	if proj.ProjectRoot != "" {
+		root := expandPath(proj.ProjectRoot)
+		if !filepath.IsAbs(root) {
+			root = filepath.Join(filepath.Dir(path), root)
+		}
+		cfg.ProjectRoot = filepath.Clean(root)
+	}
+	return nil
+}
+
 // SaveConfig saves the config to ~/.ctx/config.yaml
 func SaveConfig(cfg Config) error {
 	dir, err := ConfigDir()
@@ -131,6 +290,19 @@ func SaveConfig(cfg Config) error {
 		return err
 	}
 
+	// Don't persist project-local values into the global config
+	if cfg.project != nil {
+		if cfg.project.ActiveExclude != "" && cfg.ActiveExclude == cfg.project.ActiveExclude {
+			cfg.ActiveExclude = cfg.global.ActiveExclude
+		}
+		if len(cfg.project.SkipPrefixes) > 0 {
+			cfg.SkipPrefixes = cfg.global.SkipPrefixes
+		}
+		if cfg.project.Preamble != "" && cfg.Preamble == cfg.project.Preamble {
+			cfg.Preamble = cfg.global.Preamble
+		}
+	}
+
 	data, err := yaml.Marshal(cfg)
 	if err != nil {
 		return err
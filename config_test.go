@@ -0,0 +1,38 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// tempConfigDir points CTX_HOME at a fresh temporary directory, creates the
+// default layout in it and returns its path
+func tempConfigDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv(configDirEnv, dir)
+	if err := EnsureConfigDir(); err != nil {
+		t.Fatalf("EnsureConfigDir: %v", err)
+	}
+	return dir
+}
+
+func TestConfigDirOverride(t *testing.T) {
+	dir := tempConfigDir(t)
+
+	got, err := ConfigDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != dir {
+		t.Errorf("ConfigDir() = %s, want %s", got, dir)
+	}
+
+	history, err := HistoryDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "history"); history != want {
+		t.Errorf("HistoryDir() = %s, want %s", history, want)
+	}
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -12,9 +16,71 @@ import (
 type Context struct {
 	Name           string   `yaml:"name"`
 	ProjectRoot    string   `yaml:"project_root,omitempty"` // base path to strip from file paths
+	ExcludeRule    string   `yaml:"exclude_rule,omitempty"` // overrides the global active exclude rule
 	ProjectContext string   `yaml:"project_context"`
 	Request        string   `yaml:"request"`
 	Files          []string `yaml:"files"`
+
+	// Markdown file (and optional section heading) the project context is synced from
+	ProjectContextFile    string `yaml:"project_context_file,omitempty"`
+	ProjectContextSection string `yaml:"project_context_section,omitempty"`
+
+	// File mtimes recorded at the last successful yank
+	YankedMtimes map[string]time.Time `yaml:"yanked_mtimes,omitempty"`
+
+	// Per-file notes, emitted as a note attribute on the file's tag
+	Notes map[string]string `yaml:"notes,omitempty"`
+
+	// Files listed and yanked before all others, regardless of sort mode
+	PinnedFiles map[string]bool `yaml:"pinned_files,omitempty"`
+
+	// Files kept in the list but left out of yanks until re-enabled
+	DisabledFiles map[string]bool `yaml:"disabled_files,omitempty"`
+
+	// File the context was loaded from by LoadContextFromPath; SaveContext writes back to it
+	SourcePath string `yaml:"-"`
+}
+
+// EffectiveProjectRoot returns the context's project root, falling back to the
+// one set by a project-local config
+func EffectiveProjectRoot(cfg Config, ctx Context) string {
+	if ctx.ProjectRoot != "" {
+		return ctx.ProjectRoot
+	}
+	return cfg.ProjectRoot
+}
+
+// DetectProjectRoot guesses a project root for ctx: the nearest directory containing
+// .git at or above the files' common parent directory, else the common parent itself.
+// Without files the working directory is used as the starting point.
+func DetectProjectRoot(ctx Context) string {
+	var common string
+	for i, f := range ctx.Files {
+		dir := filepath.Dir(f)
+		if i == 0 {
+			common = dir
+			continue
+		}
+		for common != "/" && dir != common && !strings.HasPrefix(dir, common+"/") {
+			common = filepath.Dir(common)
+		}
+	}
+	if common == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return ""
+		}
+		common = wd
+	}
+
+	for dir := common; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		if filepath.Dir(dir) == dir {
+			return common
+		}
+	}
 }
 
 // LoadContext loads a context by name from ~/.ctx/contexts/
@@ -24,31 +90,61 @@ func LoadContext(name string) (Context, error) {
 		return Context{}, err
 	}
 
-	data, err := os.ReadFile(filepath.Join(dir, "contexts", name+".yaml"))
+	path := filepath.Join(dir, "contexts", name+".yaml")
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return Context{}, err
 	}
 
 	var ctx Context
-	if err := yaml.Unmarshal(data, &ctx); err != nil {
+	if err := unmarshalStrict(path, data, &ctx); err != nil {
 		return Context{}, err
 	}
 
 	return ctx, nil
 }
 
-// SaveContext saves a context to ~/.ctx/contexts/
-func SaveContext(ctx Context) error {
-	dir, err := ConfigDir()
+// LoadContextFromPath loads a context from a YAML file outside ~/.ctx/contexts/.
+// Without a name in the file, the context is named after the file.
+func LoadContextFromPath(path string) (Context, error) {
+	abs, err := filepath.Abs(expandPath(path))
 	if err != nil {
-		return err
+		return Context{}, err
+	}
+
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return Context{}, err
+	}
+
+	var ctx Context
+	if err := unmarshalStrict(path, data, &ctx); err != nil {
+		return Context{}, err
+	}
+	if ctx.Name == "" {
+		ctx.Name = strings.TrimSuffix(filepath.Base(abs), filepath.Ext(abs))
 	}
+	ctx.SourcePath = abs
 
+	return ctx, nil
+}
+
+// SaveContext saves a context to ~/.ctx/contexts/, or back to the file it was
+// loaded from if it came from LoadContextFromPath
+func SaveContext(ctx Context) error {
 	data, err := yaml.Marshal(ctx)
 	if err != nil {
 		return err
 	}
 
+	if ctx.SourcePath != "" {
+		return os.WriteFile(ctx.SourcePath, data, 0600)
+	}
+
+	dir, err := ConfigDir()
+	if err != nil {
+		return err
+	}
 	return os.WriteFile(filepath.Join(dir, "contexts", ctx.Name+".yaml"), data, 0600)
 }
 
@@ -84,12 +180,23 @@ func ContextPath(name string) (string, error) {
 	return filepath.Join(dir, "contexts", name+".yaml"), nil
 }
 
-// DeleteContext removes a context file
+// DeleteContext removes a context file, backing up its raw contents first (so a
+// context that fails to parse can still be recovered). Nothing is removed if the
+// backup can't be written.
 func DeleteContext(name string) error {
 	path, err := ContextPath(name)
 	if err != nil {
 		return err
 	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := backupContextData(name, data); err != nil {
+		return err
+	}
+
 	return os.Remove(path)
 }
 
@@ -106,6 +213,277 @@ func (ctx *Context) AddFile(path string) bool {
 	return true
 }
 
+// AddPath adds a file, or every file in a directory (filtered by exclude, and
+// down to maxDepth levels if it is positive), to the context.
+// Returns the number of files added.
+func (ctx *Context) AddPath(path string, exclude *ExcludeRule, maxDepth int) (int, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	if !stat.IsDir() {
+		if ctx.AddFile(path) {
+			return 1, nil
+		}
+		return 0, nil
+	}
+
+	files, err := ExpandDirectory(path, exclude, maxDepth)
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	for _, f := range files {
+		if ctx.AddFile(f) {
+			added++
+		}
+	}
+	return added, nil
+}
+
+// NewContextFromDir creates and saves a context named after dir's base name, with
+// ProjectRoot set to dir and every file under it (filtered by the effective exclude
+// rule) added. Returns the new context and the number of files added.
+func NewContextFromDir(dir string, cfg Config) (Context, int, error) {
+	name := sanitizeFilename(filepath.Base(dir))
+	if path, err := ContextPath(name); err == nil {
+		if _, err := os.Stat(path); err == nil {
+			return Context{}, 0, fmt.Errorf("context %q already exists", name)
+		}
+	}
+
+	ctx := Context{
+		Name:        name,
+		ProjectRoot: dir,
+		Files:       []string{},
+	}
+
+	exclude, err := LoadEffectiveExclude(cfg, ctx)
+	if err != nil {
+		return Context{}, 0, err
+	}
+
+	added, err := ctx.AddPath(dir, &exclude, cfg.MaxExpandDepth)
+	if err != nil {
+		return Context{}, 0, err
+	}
+
+	if err := SaveContext(ctx); err != nil {
+		return Context{}, 0, err
+	}
+	return ctx, added, nil
+}
+
+// ContextSize is the file count and total size of a context
+type ContextSize struct {
+	Name      string
+	FileCount int
+	TotalSize int64 // size of the files that exist
+	Missing   int
+}
+
+// ListContextSizes returns the size of every context, largest first
+func ListContextSizes() ([]ContextSize, error) {
+	names, err := ListContexts()
+	if err != nil {
+		return nil, err
+	}
+
+	var sizes []ContextSize
+	for _, name := range names {
+		ctx, err := LoadContext(name)
+		if err != nil {
+			continue // Skip malformed contexts
+		}
+		size := ContextSize{Name: name, FileCount: len(ctx.Files)}
+		for _, f := range ctx.Files {
+			stat, err := os.Stat(f)
+			if err != nil {
+				size.Missing++
+				continue
+			}
+			size.TotalSize += stat.Size()
+		}
+		sizes = append(sizes, size)
+	}
+
+	sort.Slice(sizes, func(i, j int) bool {
+		if sizes[i].TotalSize != sizes[j].TotalSize {
+			return sizes[i].TotalSize > sizes[j].TotalSize
+		}
+		return sizes[i].Name < sizes[j].Name
+	})
+	return sizes, nil
+}
+
+// LoadFallbackContext loads the "default" context, or else the first saved context
+// that loads. The error is default's if none can be loaded.
+func LoadFallbackContext() (Context, error) {
+	ctx, err := LoadContext("default")
+	if err == nil {
+		return ctx, nil
+	}
+	names, _ := ListContexts()
+	for _, name := range names {
+		if fallback, loadErr := LoadContext(name); loadErr == nil {
+			return fallback, nil
+		}
+	}
+	return Context{}, err
+}
+
+// UnloadableContexts returns the saved contexts that fail to load, with the reason
+func UnloadableContexts() map[string]error {
+	broken := make(map[string]error)
+	names, _ := ListContexts()
+	for _, name := range names {
+		if _, err := LoadContext(name); err != nil {
+			broken[name] = err
+		}
+	}
+	return broken
+}
+
+// auditContexts scans every saved context and returns the files referenced by more
+// than one context and the files that no longer exist, each mapped to the names of
+// the contexts referencing them. Contexts that can't be loaded are skipped.
+func auditContexts() (shared map[string][]string, missing map[string][]string) {
+	shared = make(map[string][]string)
+	missing = make(map[string][]string)
+
+	names, err := ListContexts()
+	if err != nil {
+		return shared, missing
+	}
+
+	users := make(map[string][]string)
+	for _, name := range names {
+		ctx, err := LoadContext(name)
+		if err != nil {
+			continue
+		}
+		for _, f := range ctx.Files {
+			users[f] = append(users[f], name)
+		}
+	}
+
+	for path, ctxNames := range users {
+		if _, err := os.Stat(path); err != nil {
+			missing[path] = ctxNames
+		}
+		if len(ctxNames) > 1 {
+			shared[path] = ctxNames
+		}
+	}
+	return shared, missing
+}
+
+// MergeContext appends from's files to into (skipping duplicates) and, if includeText
+// is set, appends its project context and request. Returns the number of files added.
+func MergeContext(into *Context, from Context, includeText bool) int {
+	added := 0
+	for _, f := range from.Files {
+		if into.AddFile(f) {
+			added++
+		}
+	}
+
+	if includeText {
+		into.ProjectContext = appendText(into.ProjectContext, from.ProjectContext)
+		into.Request = appendText(into.Request, from.Request)
+	}
+	return added
+}
+
+// appendText joins two blocks of text with a blank line, skipping empty or identical ones
+func appendText(base, extra string) string {
+	extra = strings.TrimSpace(extra)
+	if extra == "" || strings.Contains(base, extra) {
+		return base
+	}
+	if strings.TrimSpace(base) == "" {
+		return extra + "\n"
+	}
+	return strings.TrimRight(base, "\n") + "\n\n" + extra + "\n"
+}
+
+// RenameFile replaces oldPath with newPath in place, keeping its position and
+// per-file metadata. Returns false if oldPath isn't in the context or newPath already is.
+func (ctx *Context) RenameFile(oldPath, newPath string) bool {
+	idx := -1
+	for i, f := range ctx.Files {
+		if f == newPath {
+			return false
+		}
+		if f == oldPath {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		return false
+	}
+	ctx.Files[idx] = newPath
+
+	if mtime, ok := ctx.YankedMtimes[oldPath]; ok {
+		delete(ctx.YankedMtimes, oldPath)
+		ctx.YankedMtimes[newPath] = mtime
+	}
+	if note, ok := ctx.Notes[oldPath]; ok {
+		delete(ctx.Notes, oldPath)
+		ctx.Notes[newPath] = note
+	}
+	if ctx.PinnedFiles[oldPath] {
+		delete(ctx.PinnedFiles, oldPath)
+		ctx.PinnedFiles[newPath] = true
+	}
+	if ctx.DisabledFiles[oldPath] {
+		delete(ctx.DisabledFiles, oldPath)
+		ctx.DisabledFiles[newPath] = true
+	}
+	return true
+}
+
+// TogglePin pins or unpins a file in the context. Returns true if it is now pinned.
+func (ctx *Context) TogglePin(path string) bool {
+	if ctx.PinnedFiles[path] {
+		delete(ctx.PinnedFiles, path)
+		return false
+	}
+	if ctx.PinnedFiles == nil {
+		ctx.PinnedFiles = make(map[string]bool)
+	}
+	ctx.PinnedFiles[path] = true
+	return true
+}
+
+// ToggleDisabled disables or re-enables a file in the context. Returns true if it
+// is now disabled.
+func (ctx *Context) ToggleDisabled(path string) bool {
+	if ctx.DisabledFiles[path] {
+		delete(ctx.DisabledFiles, path)
+		return false
+	}
+	if ctx.DisabledFiles == nil {
+		ctx.DisabledFiles = make(map[string]bool)
+	}
+	ctx.DisabledFiles[path] = true
+	return true
+}
+
+// SetNote sets the note for a file in the context; an empty note removes it
+func (ctx *Context) SetNote(path, note string) {
+	if note == "" {
+		delete(ctx.Notes, path)
+		return
+	}
+	if ctx.Notes == nil {
+		ctx.Notes = make(map[string]string)
+	}
+	ctx.Notes[path] = note
+}
+
 // RemoveFile removes a file path from the context
 func (ctx *Context) RemoveFile(path string) {
 	var newFiles []string
@@ -115,6 +493,96 @@ func (ctx *Context) RemoveFile(path string) {
 		}
 	}
 	ctx.Files = newFiles
+	delete(ctx.Notes, path)
+	delete(ctx.PinnedFiles, path)
+	delete(ctx.DisabledFiles, path)
+}
+
+// Compact removes files that no longer exist and repeated paths (compared after
+// filepath.Clean), keeping the first occurrence. Returns the number of missing
+// and duplicate entries removed.
+func (ctx *Context) Compact() (missing int, duplicates int) {
+	seen := make(map[string]bool, len(ctx.Files))
+	var kept []string
+	var drop []string
+	for _, f := range ctx.Files {
+		clean := filepath.Clean(f)
+		switch {
+		case seen[clean]:
+			duplicates++
+			// Only drop notes/pins if the path itself doesn't survive
+			if !slices.Contains(kept, f) {
+				drop = append(drop, f)
+			}
+		case !fileExists(f):
+			missing++
+			drop = append(drop, f)
+		default:
+			seen[clean] = true
+			kept = append(kept, f)
+		}
+	}
+	ctx.Files = kept
+	for _, f := range drop {
+		delete(ctx.Notes, f)
+		delete(ctx.PinnedFiles, f)
+		delete(ctx.DisabledFiles, f)
+	}
+	return missing, duplicates
+}
+
+// fileExists reports whether path can be stat'ed
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// CompactSummary is what CompactAllContexts did to one context
+type CompactSummary struct {
+	Name       string
+	Missing    int
+	Duplicates int
+	Err        error // the context couldn't be loaded or saved
+}
+
+// CompactAllContexts runs Compact on every saved context, backing up and saving the
+// ones that changed
+func CompactAllContexts() ([]CompactSummary, error) {
+	names, err := ListContexts()
+	if err != nil {
+		return nil, err
+	}
+
+	var summaries []CompactSummary
+	for _, name := range names {
+		s := CompactSummary{Name: name}
+		ctx, err := LoadContext(name)
+		if err != nil {
+			s.Err = err
+			summaries = append(summaries, s)
+			continue
+		}
+
+		original := ctx
+		s.Missing, s.Duplicates = ctx.Compact()
+		if s.Missing+s.Duplicates > 0 {
+			backupContext(original)
+			s.Err = SaveContext(ctx)
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, nil
+}
+
+// String describes the summary on one line, e.g. "api: removed 2 missing, 1 duplicate"
+func (s CompactSummary) String() string {
+	switch {
+	case s.Err != nil:
+		return fmt.Sprintf("%s: error: %v", s.Name, s.Err)
+	case s.Missing+s.Duplicates == 0:
+		return s.Name + ": clean"
+	}
+	return fmt.Sprintf("%s: removed %d missing, %d duplicate", s.Name, s.Missing, s.Duplicates)
 }
 
 // RemoveFiles removes multiple file paths from the context
@@ -128,6 +596,10 @@ func (ctx *Context) RemoveFiles(paths []string) {
 	for _, f := range ctx.Files {
 		if !pathSet[f] {
 			newFiles = append(newFiles, f)
+		} else {
+			delete(ctx.Notes, f)
+			delete(ctx.PinnedFiles, f)
+			delete(ctx.DisabledFiles, f)
 		}
 	}
 	ctx.Files = newFiles
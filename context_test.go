@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSaveLoadContext(t *testing.T) {
+	tempConfigDir(t)
+
+	ctx := Context{
+		Name:           "api",
+		ProjectRoot:    "/src/api",
+		ProjectContext: "Go service",
+		Request:        "Fix the handler",
+		Files:          []string{"/src/api/main.go", "/src/api/handler.go"},
+		Notes:          map[string]string{"/src/api/handler.go": "the buggy one"},
+	}
+	if err := SaveContext(ctx); err != nil {
+		t.Fatalf("SaveContext: %v", err)
+	}
+
+	got, err := LoadContext("api")
+	if err != nil {
+		t.Fatalf("LoadContext: %v", err)
+	}
+	if got.Name != ctx.Name || got.ProjectRoot != ctx.ProjectRoot ||
+		got.ProjectContext != ctx.ProjectContext || got.Request != ctx.Request {
+		t.Errorf("LoadContext = %+v, want %+v", got, ctx)
+	}
+	if !slices.Equal(got.Files, ctx.Files) {
+		t.Errorf("files = %v, want %v", got.Files, ctx.Files)
+	}
+	if got.Notes["/src/api/handler.go"] != "the buggy one" {
+		t.Errorf("notes = %v, want %v", got.Notes, ctx.Notes)
+	}
+
+	names, err := ListContexts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(names, "api") || !slices.Contains(names, "default") {
+		t.Errorf("ListContexts() = %v, want api and default", names)
+	}
+}
+
+func TestLoadContextMissing(t *testing.T) {
+	tempConfigDir(t)
+
+	if _, err := LoadContext("nope"); err == nil {
+		t.Error("LoadContext of a missing context succeeded")
+	}
+}
+
+func TestDeleteContextBacksUpBrokenContext(t *testing.T) {
+	tempConfigDir(t)
+
+	path, err := ContextPath("broken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("files: [unterminated\n")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteContext("broken"); err != nil {
+		t.Fatalf("DeleteContext: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("context file still exists: %v", err)
+	}
+
+	backups, err := ListBackups()
+	if err != nil || len(backups) != 1 || backupContextName(backups[0]) != "broken" {
+		t.Fatalf("ListBackups() = %v, %v, want one backup of broken", backups, err)
+	}
+	dir, _ := BackupDir()
+	got, err := os.ReadFile(filepath.Join(dir, backups[0]+".yaml"))
+	if err != nil || string(got) != string(data) {
+		t.Errorf("backup = %q, %v, want %q", got, err, data)
+	}
+}
+
+func TestBackupsWithinOneSecond(t *testing.T) {
+	tempConfigDir(t)
+
+	for i := range 3 {
+		if err := backupContextData("api", []byte(fmt.Sprintf("request: r%d\n", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// All three are kept, newest first, even within the same second
+	backups, err := ListBackups()
+	if err != nil || len(backups) != 3 {
+		t.Fatalf("ListBackups() = %v, %v, want 3 backups", backups, err)
+	}
+	if ctx, err := LoadBackup(backups[0]); err != nil || ctx.Request != "r2" {
+		t.Errorf("newest backup %s = %q, %v, want r2", backups[0], ctx.Request, err)
+	}
+	for _, b := range backups {
+		if backupContextName(b) != "api" {
+			t.Errorf("backupContextName(%s) = %q, want api", b, backupContextName(b))
+		}
+	}
+}
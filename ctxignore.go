@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// ctxIgnoreName is the filename of a project's prompt-specific ignore list
+const ctxIgnoreName = ".ctxignore"
+
+// ctxIgnore holds the patterns of one .ctxignore file. They use the exclude rule
+// glob syntax and are matched against paths relative to the file's directory
+// (and against the name alone), so "fixtures/**" and "*.snap" both work.
+type ctxIgnore struct {
+	dir      string
+	patterns []string
+}
+
+// ctxIgnores is every .ctxignore that applies during one directory walk
+type ctxIgnores []ctxIgnore
+
+// loadCtxIgnore reads dir/.ctxignore: one pattern per line, blank lines and lines
+// starting with # ignored. A leading or trailing / is dropped. Returns false if
+// there is no such file or it has no patterns.
+func loadCtxIgnore(dir string) (ctxIgnore, bool) {
+	data, err := os.ReadFile(filepath.Join(dir, ctxIgnoreName))
+	if err != nil {
+		return ctxIgnore{}, false
+	}
+
+	ci := ctxIgnore{dir: dir}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.Trim(line, "/")
+		if line != "" {
+			ci.patterns = append(ci.patterns, line)
+		}
+	}
+	return ci, len(ci.patterns) > 0
+}
+
+// findCtxIgnores loads the .ctxignore files in dir and its parents, stopping at
+// the repository root (a directory containing .git) like .ctx.yaml lookup
+func findCtxIgnores(dir string) ctxIgnores {
+	var ignores ctxIgnores
+	for {
+		if ci, ok := loadCtxIgnore(dir); ok {
+			ignores = append(ignores, ci)
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return ignores
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ignores
+		}
+		dir = parent
+	}
+}
+
+// enter adds the .ctxignore of a directory the walk descends into, if it has one
+func (ignores *ctxIgnores) enter(dir string) {
+	if ci, ok := loadCtxIgnore(dir); ok {
+		*ignores = append(*ignores, ci)
+	}
+}
+
+// matchingPattern returns the first pattern of a .ctxignore above path that
+// matches it (prefixed with the file it came from), or ""
+func (ignores ctxIgnores) matchingPattern(path string) string {
+	for _, ci := range ignores {
+		rel, err := filepath.Rel(ci.dir, path)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for _, pattern := range ci.patterns {
+			relMatch, _ := doublestar.Match(pattern, rel)
+			nameMatch, _ := doublestar.Match(pattern, filepath.Base(path))
+			if relMatch || nameMatch {
+				return filepath.Join(ci.dir, ctxIgnoreName) + ": " + pattern
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+)
+
+// findContentDuplicates groups existing files by content hash and returns only the
+// groups with more than one file, keyed by hex SHA-256. Paths within a group keep
+// the order of files.
+func findContentDuplicates(files []FileInfo) map[string][]string {
+	// Only files of equal size can be identical, so skip hashing unique sizes
+	bySize := make(map[int64]int)
+	for _, f := range files {
+		if f.Exists {
+			bySize[f.Size]++
+		}
+	}
+
+	byHash := make(map[string][]string)
+	for _, f := range files {
+		if !f.Exists || bySize[f.Size] < 2 {
+			continue
+		}
+		sum, err := hashFile(f.Path)
+		if err != nil {
+			continue
+		}
+		byHash[sum] = append(byHash[sum], f.Path)
+	}
+
+	for sum, paths := range byHash {
+		if len(paths) < 2 {
+			delete(byHash, sum)
+		}
+	}
+	return byHash
+}
+
+// hashFile returns the hex SHA-256 of a file's content
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -13,6 +13,37 @@ import (
 type ExcludeRule struct {
 	Name     string   `yaml:"name"`
 	Patterns []string `yaml:"patterns"`
+	MaxBytes int64    `yaml:"max_bytes,omitempty"` // files larger than this are excluded (0 = no limit)
+	MinBytes int64    `yaml:"min_bytes,omitempty"` // files smaller than this are excluded (0 = no limit)
+	Include  []string `yaml:"include,omitempty"`   // hidden files/directories to keep when hidden entries are skipped
+
+	// SkipHidden drops dotfiles and dot-directories during directory expansion.
+	// Set from Config.IncludeHidden when the rule is loaded, never saved.
+	SkipHidden bool `yaml:"-"`
+
+	// SkipConfigDir drops ctx's own config directory (~/.ctx) during expansion.
+	// Set from Config.IncludeConfigDir when the rule is loaded, never saved.
+	SkipConfigDir bool `yaml:"-"`
+
+	// Root is the project root; patterns are also matched against paths relative
+	// to it, so "internal/secret/**" works without a "**/" prefix.
+	// Set from the effective project root when the rule is loaded, never saved.
+	Root string `yaml:"-"`
+}
+
+// DefaultExcludePatterns returns the patterns of the default exclude rule written
+// on first run (and restored by "reset exclude rule to defaults")
+func DefaultExcludePatterns() []string {
+	return []string{
+		"**/node_modules/**",
+		"**/.git/**",
+		"**/.env",
+		"**/.env.*",
+		"**/*.env",
+		"**/package-lock.json",
+		"**/pnpm-lock.yaml",
+		"**/yarn.lock",
+	}
 }
 
 // LoadExcludeRule loads an exclude rule by name from ~/.ctx/excludes/
@@ -22,13 +53,14 @@ func LoadExcludeRule(name string) (ExcludeRule, error) {
 		return ExcludeRule{}, err
 	}
 
-	data, err := os.ReadFile(filepath.Join(dir, "excludes", name+".yaml"))
+	path := filepath.Join(dir, "excludes", name+".yaml")
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return ExcludeRule{}, err
 	}
 
 	var exc ExcludeRule
-	if err := yaml.Unmarshal(data, &exc); err != nil {
+	if err := unmarshalStrict(path, data, &exc); err != nil {
 		return ExcludeRule{}, err
 	}
 
@@ -73,42 +105,337 @@ func ListExcludeRules() ([]string, error) {
 	return names, nil
 }
 
+// LoadEffectiveExclude loads the context's own exclude rule if set, falling back to
+// the global active rule when unset or when the context's rule can't be loaded
+func LoadEffectiveExclude(cfg Config, ctx Context) (ExcludeRule, error) {
+	exc, err := loadEffectiveRule(cfg, ctx)
+	if err != nil {
+		return ExcludeRule{}, err
+	}
+	exc.SkipHidden = !cfg.IncludeHidden
+	exc.SkipConfigDir = !cfg.IncludeConfigDir
+	exc.Root = EffectiveProjectRoot(cfg, ctx)
+	return exc, nil
+}
+
+// loadEffectiveRule loads the rule file LoadEffectiveExclude picks
+func loadEffectiveRule(cfg Config, ctx Context) (ExcludeRule, error) {
+	if ctx.ExcludeRule != "" {
+		if exc, err := LoadExcludeRule(ctx.ExcludeRule); err == nil {
+			return exc, nil
+		}
+	}
+	return LoadExcludeRule(cfg.ActiveExclude)
+}
+
+// AddPattern appends pattern unless the rule already has it. Returns true if it was added.
+func (exc *ExcludeRule) AddPattern(pattern string) bool {
+	for _, p := range exc.Patterns {
+		if p == pattern {
+			return false
+		}
+	}
+	exc.Patterns = append(exc.Patterns, pattern)
+	return true
+}
+
 // ShouldExclude checks if a path should be excluded based on the patterns
 func (exc *ExcludeRule) ShouldExclude(path string) bool {
+	return exc.MatchingPattern(path) != ""
+}
+
+// ShouldExcludeFile checks a file against both the patterns and the size limits
+func (exc *ExcludeRule) ShouldExcludeFile(path string, size int64) bool {
+	return exc.fileExcludeReason(path, size) != ""
+}
+
+// fileExcludeReason returns the pattern or size limit that excludes a file, or ""
+func (exc *ExcludeRule) fileExcludeReason(path string, size int64) string {
+	if pattern := exc.MatchingPattern(path); pattern != "" {
+		return pattern
+	}
+	if exc.MaxBytes > 0 && size > exc.MaxBytes {
+		return "larger than " + formatSize(exc.MaxBytes)
+	}
+	if exc.MinBytes > 0 && size < exc.MinBytes {
+		return "smaller than " + formatSize(exc.MinBytes)
+	}
+	return ""
+}
+
+// fileSize returns the size of a walked file, or 0 if it can't be determined
+func fileSize(d os.DirEntry) int64 {
+	info, err := d.Info()
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// MatchingPattern returns the first pattern that excludes path, or "" if none does
+func (exc *ExcludeRule) MatchingPattern(path string) string {
 	for _, pattern := range exc.Patterns {
 		// Try matching the full path
 		if matched, _ := doublestar.Match(pattern, path); matched {
-			return true
+			return pattern
 		}
 		// Also try matching just the relative part (after any common prefix)
 		// This helps with patterns like "**/node_modules/**"
 		if matched, _ := doublestar.Match(pattern, filepath.Base(path)); matched {
+			return pattern
+		}
+		// And the path relative to the project root, for patterns like "internal/secret/**"
+		if rel := exc.rootRelative(path); rel != "" {
+			if matched, _ := doublestar.Match(pattern, rel); matched {
+				return pattern
+			}
+		}
+	}
+	return ""
+}
+
+// rootRelative returns path relative to the project root (slash-separated), or ""
+// if there is no root or path isn't below it
+func (exc *ExcludeRule) rootRelative(path string) string {
+	if exc.Root == "" {
+		return ""
+	}
+	rel, err := filepath.Rel(exc.Root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// skipHidden reports whether a walked entry should be skipped for being hidden
+// (its name starts with ".") and not matched by an include pattern. Include
+// patterns match like exclude patterns: the full path, the name, or the path
+// relative to the project root.
+func (exc *ExcludeRule) skipHidden(path string) bool {
+	if !exc.SkipHidden || !strings.HasPrefix(filepath.Base(path), ".") {
+		return false
+	}
+	return !exc.includeMatches(path)
+}
+
+// hiddenCheck is skipHidden for a directory walk. A hidden directory that doesn't
+// match an include pattern itself is still entered (partial) when one could match
+// something inside it, like "**/.github/workflows/*.yml" for .github. Inside such a
+// directory (inPartial) every entry has to match, or lead to a match, to be kept.
+func (exc *ExcludeRule) hiddenCheck(path string, isDir, inPartial bool) (skip, partial bool) {
+	if !exc.SkipHidden || (!inPartial && !strings.HasPrefix(filepath.Base(path), ".")) {
+		return false, false
+	}
+	if exc.includeMatches(path) {
+		return false, false
+	}
+	if isDir && exc.includeBelow(path) {
+		return false, true
+	}
+	return true, false
+}
+
+// includeMatches reports whether an include pattern matches path
+func (exc *ExcludeRule) includeMatches(path string) bool {
+	rel := exc.rootRelative(path)
+	for _, pattern := range exc.Include {
+		if matched, _ := doublestar.Match(pattern, path); matched {
+			return true
+		}
+		if matched, _ := doublestar.Match(pattern, filepath.Base(path)); matched {
+			return true
+		}
+		if rel != "" {
+			if matched, _ := doublestar.Match(pattern, rel); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// includeBelow reports whether an include pattern could match something inside
+// dir: the directory (full or root-relative) matches the pattern's leading segments
+func (exc *ExcludeRule) includeBelow(dir string) bool {
+	full := strings.Split(filepath.ToSlash(dir), "/")
+	var rel []string
+	if r := exc.rootRelative(dir); r != "" {
+		rel = strings.Split(r, "/")
+	}
+	for _, pattern := range exc.Include {
+		segs := strings.Split(pattern, "/")
+		if matchesLeading(segs, full) || (rel != nil && matchesLeading(segs, rel)) {
 			return true
 		}
 	}
 	return false
 }
 
-// ExpandDirectory recursively lists all files in a directory, filtered by exclude rules
-func ExpandDirectory(dir string, exclude *ExcludeRule) ([]string, error) {
+// matchesLeading reports whether path segments match the start of pattern segments
+// with something left over for entries below, "**" standing for any number of them
+func matchesLeading(pattern, path []string) bool {
+	if len(path) == 0 {
+		return len(pattern) > 0
+	}
+	if len(pattern) == 0 {
+		return false
+	}
+	if pattern[0] == "**" {
+		return matchesLeading(pattern[1:], path) || matchesLeading(pattern, path[1:])
+	}
+	if matched, _ := doublestar.Match(pattern[0], path[0]); !matched {
+		return false
+	}
+	return matchesLeading(pattern[1:], path[1:])
+}
+
+// inConfigDir reports whether path is ctx's own config directory or inside it,
+// when the rule skips it
+func (exc *ExcludeRule) inConfigDir(path string) bool {
+	if !exc.SkipConfigDir {
+		return false
+	}
+	dir, err := ConfigDir()
+	if err != nil {
+		return false
+	}
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// ExcludedPath is a file or directory filtered out by an exclude rule
+type ExcludedPath struct {
+	Path    string
+	Pattern string // the pattern (or size limit) that matched
+	IsDir   bool   // directories are skipped without listing their contents
+}
+
+// ExcludeTestResult is what an exclude rule would do to a directory
+type ExcludeTestResult struct {
+	Dir      string
+	Included []string
+	Excluded []ExcludedPath
+}
+
+// TestExcludeRule walks dir like ExpandDirectory, but also records what was excluded and why
+func TestExcludeRule(dir string, exclude *ExcludeRule) (ExcludeTestResult, error) {
+	result := ExcludeTestResult{Dir: dir}
+	ignores := findCtxIgnores(dir)
+	partial := make(map[string]bool) // hidden directories entered only for an include below them
+
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() && exclude.inConfigDir(path) {
+			result.Excluded = append(result.Excluded, ExcludedPath{Path: path, Pattern: "ctx config dir", IsDir: true})
+			return filepath.SkipDir
+		}
+
+		if path != dir {
+			skip, below := exclude.hiddenCheck(path, d.IsDir(), partial[filepath.Dir(path)])
+			if skip {
+				result.Excluded = append(result.Excluded, ExcludedPath{Path: path, Pattern: "hidden", IsDir: d.IsDir()})
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if below {
+				partial[path] = true
+			}
+		}
+
+		if pattern := ignores.matchingPattern(path); pattern != "" {
+			result.Excluded = append(result.Excluded, ExcludedPath{Path: path, Pattern: pattern, IsDir: d.IsDir()})
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			if pattern := exclude.MatchingPattern(path); pattern != "" {
+				result.Excluded = append(result.Excluded, ExcludedPath{Path: path, Pattern: pattern, IsDir: true})
+				return filepath.SkipDir
+			}
+			if path != dir {
+				ignores.enter(path)
+			}
+			return nil
+		}
+
+		if reason := exclude.fileExcludeReason(path, fileSize(d)); reason != "" {
+			result.Excluded = append(result.Excluded, ExcludedPath{Path: path, Pattern: reason})
+			return nil
+		}
+
+		result.Included = append(result.Included, path)
+		return nil
+	})
+
+	return result, err
+}
+
+// ExpandDirectory recursively lists all files in a directory, filtered by exclude rules.
+// With maxDepth > 0 it stops that many levels down: files directly in dir are at
+// depth 1, files in its subdirectories at depth 2, and so on. 0 means unlimited.
+// Patterns from .ctxignore files in dir, its parents up to the repository root and
+// the subdirectories walked are applied on top of exclude.
+func ExpandDirectory(dir string, exclude *ExcludeRule, maxDepth int) ([]string, error) {
 	var files []string
+	ignores := findCtxIgnores(dir)
+	partial := make(map[string]bool) // hidden directories entered only for an include below them
 
 	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
+		// Never descend into ~/.ctx, even when it is the walked directory
+		if d.IsDir() && exclude != nil && exclude.inConfigDir(path) {
+			return filepath.SkipDir
+		}
+
+		// Skip dotfiles and dot-directories (the walked directory itself is always entered)
+		if path != dir && exclude != nil {
+			skip, below := exclude.hiddenCheck(path, d.IsDir(), partial[filepath.Dir(path)])
+			if skip {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if below {
+				partial[path] = true
+			}
+		}
+
+		if ignores.matchingPattern(path) != "" {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
 		// Skip directories themselves, we only want files
 		if d.IsDir() {
 			// Check if this directory should be excluded
 			if exclude != nil && exclude.ShouldExclude(path) {
 				return filepath.SkipDir
 			}
+			// Its files would be deeper than the limit
+			if maxDepth > 0 && path != dir && walkDepth(dir, path) >= maxDepth {
+				return filepath.SkipDir
+			}
+			if path != dir {
+				ignores.enter(path)
+			}
 			return nil
 		}
 
 		// Check if file should be excluded
-		if exclude != nil && exclude.ShouldExclude(path) {
+		if exclude != nil && exclude.ShouldExcludeFile(path, fileSize(d)) {
 			return nil
 		}
 
@@ -118,3 +445,39 @@ func ExpandDirectory(dir string, exclude *ExcludeRule) ([]string, error) {
 
 	return files, err
 }
+
+// walkDepth returns how many levels below dir path is (1 for a direct child)
+func walkDepth(dir, path string) int {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// HasGlobMeta reports whether a path contains glob metacharacters
+func HasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, "*?[{")
+}
+
+// ExpandGlob lists all files matching a doublestar glob pattern, filtered by exclude rules
+func ExpandGlob(pattern string, exclude *ExcludeRule) ([]string, error) {
+	matches, err := doublestar.FilepathGlob(pattern, doublestar.WithFilesOnly())
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, path := range matches {
+		var size int64
+		if stat, err := os.Stat(path); err == nil {
+			size = stat.Size()
+		}
+		if exclude != nil && (exclude.inConfigDir(path) || exclude.ShouldExcludeFile(path, size)) {
+			continue
+		}
+		files = append(files, path)
+	}
+
+	return files, nil
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSaveExcludeRuleShouldExclude(t *testing.T) {
+	tempConfigDir(t)
+
+	if err := SaveExcludeRule(ExcludeRule{Name: "go", Patterns: []string{"**/vendor/**", "**/*_test.go"}}); err != nil {
+		t.Fatalf("SaveExcludeRule: %v", err)
+	}
+	exc, err := LoadExcludeRule("go")
+	if err != nil {
+		t.Fatalf("LoadExcludeRule: %v", err)
+	}
+
+	for _, tc := range []struct {
+		path string
+		want bool
+	}{
+		{"/src/app/main.go", false},
+		{"/src/app/main_test.go", true},
+		{"/src/app/vendor/lib/lib.go", true},
+		{"/src/app/vendored.go", false},
+	} {
+		if got := exc.ShouldExclude(tc.path); got != tc.want {
+			t.Errorf("ShouldExclude(%s) = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestShouldExcludeRootRelative(t *testing.T) {
+	exc := ExcludeRule{
+		Patterns: []string{"internal/secret/**", "docs/*.md", "**/*.log"},
+		Root:     "/src/app",
+	}
+
+	for _, tc := range []struct {
+		path string
+		want bool
+	}{
+		{"/src/app/internal/secret/key.go", true},
+		{"/src/app/internal/secret", true},
+		{"/src/app/internal/public/api.go", false},
+		{"/src/app/docs/guide.md", true},
+		{"/src/app/docs/deep/guide.md", false},
+		{"/src/app/tmp/run.log", true},           // absolute matches still apply
+		{"/other/internal/secret/key.go", false}, // outside the root
+		{"/src/application/docs/guide.md", false},
+	} {
+		if got := exc.ShouldExclude(tc.path); got != tc.want {
+			t.Errorf("ShouldExclude(%s) = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+
+	// Include patterns are matched against the root-relative path too
+	exc.SkipHidden = true
+	exc.Include = []string{"config/.env"}
+	if exc.skipHidden("/src/app/config/.env") {
+		t.Error("include config/.env didn't match /src/app/config/.env")
+	}
+	if !exc.skipHidden("/src/app/other/.env") {
+		t.Error("include config/.env matched /src/app/other/.env")
+	}
+
+	// Without a root, root-relative patterns don't match absolute paths
+	exc.Root = ""
+	if exc.ShouldExclude("/src/app/internal/secret/key.go") {
+		t.Error("internal/secret/** matched without a project root")
+	}
+	if !exc.skipHidden("/src/app/config/.env") {
+		t.Error("include config/.env matched without a project root")
+	}
+}
+
+func TestLoadEffectiveExcludeRoot(t *testing.T) {
+	tempConfigDir(t)
+
+	exc, err := LoadEffectiveExclude(Config{ActiveExclude: "default"}, Context{ProjectRoot: "/src/app"})
+	if err != nil {
+		t.Fatalf("LoadEffectiveExclude: %v", err)
+	}
+	if exc.Root != "/src/app" {
+		t.Errorf("Root = %q, want /src/app", exc.Root)
+	}
+
+	exc, err = LoadEffectiveExclude(Config{ActiveExclude: "default", ProjectRoot: "/proj"}, Context{})
+	if err != nil {
+		t.Fatalf("LoadEffectiveExclude: %v", err)
+	}
+	if exc.Root != "/proj" {
+		t.Errorf("Root = %q, want the .ctx.yaml root /proj", exc.Root)
+	}
+}
+
+func TestExpandDirectory(t *testing.T) {
+	root := t.TempDir()
+	// A config dir inside the walked tree (not hidden, so only SkipConfigDir keeps it out)
+	configDir := filepath.Join(root, "ctxhome")
+	t.Setenv(configDirEnv, configDir)
+	if err := EnsureConfigDir(); err != nil {
+		t.Fatalf("EnsureConfigDir: %v", err)
+	}
+
+	for path, size := range map[string]int{
+		"main.go":              10,
+		"main_test.go":         10,
+		"pkg/util.go":          10,
+		"pkg/big.go":           5000,
+		"node_modules/x/x.js":  10,
+		".hidden/secret.txt":   10,
+		".env":                 10,
+		"docs/guide/readme.md": 10,
+	} {
+		writeFile(t, filepath.Join(root, path), size)
+	}
+	writeFile(t, filepath.Join(configDir, "contexts", "x.yaml"), 10)
+
+	exc := ExcludeRule{
+		Patterns:      []string{"**/node_modules/**", "**/*_test.go"},
+		MaxBytes:      1000,
+		SkipHidden:    true,
+		SkipConfigDir: true,
+	}
+	files, err := ExpandDirectory(root, &exc, 0)
+	if err != nil {
+		t.Fatalf("ExpandDirectory: %v", err)
+	}
+
+	var got []string
+	for _, f := range files {
+		rel, _ := filepath.Rel(root, f)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	slices.Sort(got)
+	want := []string{"docs/guide/readme.md", "main.go", "pkg/util.go"}
+	if !slices.Equal(got, want) {
+		t.Errorf("ExpandDirectory = %v, want %v", got, want)
+	}
+
+	if files, err := ExpandDirectory(configDir, &exc, 0); err != nil || len(files) != 0 {
+		t.Errorf("ExpandDirectory(config dir) = %v, %v, want nothing", files, err)
+	}
+}
+
+func TestExpandDirectoryDepth(t *testing.T) {
+	root := t.TempDir()
+	for _, path := range []string{"a.go", "pkg/b.go", "pkg/sub/c.go", "pkg/sub/deep/d.go"} {
+		writeFile(t, filepath.Join(root, path), 10)
+	}
+
+	for _, tc := range []struct {
+		depth int
+		want  []string
+	}{
+		{0, []string{"a.go", "pkg/b.go", "pkg/sub/c.go", "pkg/sub/deep/d.go"}},
+		{1, []string{"a.go"}},
+		{2, []string{"a.go", "pkg/b.go"}},
+		{3, []string{"a.go", "pkg/b.go", "pkg/sub/c.go"}},
+	} {
+		files, err := ExpandDirectory(root, nil, tc.depth)
+		if err != nil {
+			t.Fatalf("ExpandDirectory(depth %d): %v", tc.depth, err)
+		}
+		var got []string
+		for _, f := range files {
+			rel, _ := filepath.Rel(root, f)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("depth %d: got %v, want %v", tc.depth, got, tc.want)
+		}
+	}
+}
+
+func TestExpandDirectoryIncludeInsideHidden(t *testing.T) {
+	root := t.TempDir()
+	for _, path := range []string{
+		"main.go",
+		".github/CODEOWNERS",
+		".github/workflows/ci.yml",
+		".github/workflows/notes.txt",
+		".github/workflows/.cache/x.yml",
+		".vscode/settings.json",
+	} {
+		writeFile(t, filepath.Join(root, path), 10)
+	}
+
+	exc := ExcludeRule{SkipHidden: true, Include: []string{"**/.github/workflows/*.yml"}}
+	files, err := ExpandDirectory(root, &exc, 0)
+	if err != nil {
+		t.Fatalf("ExpandDirectory: %v", err)
+	}
+	var got []string
+	for _, f := range files {
+		rel, _ := filepath.Rel(root, f)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	slices.Sort(got)
+	want := []string{".github/workflows/ci.yml", "main.go"}
+	if !slices.Equal(got, want) {
+		t.Errorf("ExpandDirectory = %v, want %v", got, want)
+	}
+
+	result, err := TestExcludeRule(root, &exc)
+	if err != nil {
+		t.Fatalf("TestExcludeRule: %v", err)
+	}
+	if len(result.Included) != len(want) {
+		t.Errorf("TestExcludeRule included %v, want %d files", result.Included, len(want))
+	}
+}
+
+func TestExpandDirectoryCtxIgnore(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"main.go", "debug.log", "fixtures/big.json", "sub/a.go", "sub/gen.go", "sub/out.log"} {
+		writeFile(t, filepath.Join(root, path), 10)
+	}
+	writeIgnore := func(dir, content string) {
+		if err := os.WriteFile(filepath.Join(dir, ctxIgnoreName), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeIgnore(root, "# generated\n*.log\n/fixtures/\n")
+	writeIgnore(filepath.Join(root, "sub"), "gen.go\n")
+
+	exc := ExcludeRule{SkipHidden: true}
+	for _, tc := range []struct {
+		dir  string
+		want []string
+	}{
+		{root, []string{"main.go", "sub/a.go"}},
+		// The root .ctxignore still applies when expanding a subdirectory
+		{filepath.Join(root, "sub"), []string{"sub/a.go"}},
+	} {
+		files, err := ExpandDirectory(tc.dir, &exc, 0)
+		if err != nil {
+			t.Fatalf("ExpandDirectory(%s): %v", tc.dir, err)
+		}
+		var got []string
+		for _, f := range files {
+			rel, _ := filepath.Rel(root, f)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("ExpandDirectory(%s) = %v, want %v", tc.dir, got, tc.want)
+		}
+	}
+}
+
+// writeFile creates path (and its parents) with size bytes of content
+func writeFile(t *testing.T, path string, size int) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitOutput runs git with args in dir and returns its stdout. Errors include
+// git's stderr, e.g. "not a git repository".
+func gitOutput(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return out, nil
+}
+
+// GitChangedFiles returns the absolute paths of files with uncommitted changes in
+// the repository containing dir: modified, added, renamed (the new name) and
+// untracked files. Deleted files are left out.
+func GitChangedFiles(dir string) ([]string, error) {
+	top, err := gitOutput(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	root := strings.TrimSpace(string(top))
+
+	// -z keeps paths unquoted; a rename is "R  new\0old\0"
+	out, err := gitOutput(dir, "status", "--porcelain", "-z", "--untracked-files=all")
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	fields := strings.Split(string(out), "\x00")
+	for i := 0; i < len(fields); i++ {
+		entry := fields[i]
+		if len(entry) < 4 {
+			continue
+		}
+		status, path := entry[:2], entry[3:]
+
+		if status[0] == 'R' || status[0] == 'C' {
+			i++ // skip the original path
+		}
+		if status[0] == 'D' || status[1] == 'D' {
+			continue
+		}
+		files = append(files, filepath.Join(root, path))
+	}
+	return files, nil
+}
+
+// GitDiff returns the staged and unstaged changes of the repository containing dir
+// against HEAD. In a repository without commits it falls back to the staged diff
+// followed by the unstaged one.
+func GitDiff(dir string) (string, error) {
+	if out, err := gitOutput(dir, "diff", "HEAD"); err == nil {
+		return string(out), nil
+	}
+
+	staged, err := gitOutput(dir, "diff", "--cached")
+	if err != nil {
+		return "", err
+	}
+	unstaged, err := gitOutput(dir, "diff")
+	if err != nil {
+		return "", err
+	}
+	return string(staged) + string(unstaged), nil
+}
+
+// AddGitChanges adds the uncommitted changes of the repository containing dir
+// (see GitChangedFiles) to the context, filtered by exclude. Returns the number
+// of files added and the number of changed files found.
+func (ctx *Context) AddGitChanges(dir string, exclude *ExcludeRule) (int, int, error) {
+	changed, err := GitChangedFiles(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	added := 0
+	for _, path := range changed {
+		stat, err := os.Stat(path)
+		if err != nil || stat.IsDir() {
+			continue
+		}
+		if exclude != nil && exclude.ShouldExcludeFile(path, stat.Size()) {
+			continue
+		}
+		if ctx.AddFile(path) {
+			added++
+		}
+	}
+	return added, len(changed), nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Styles for highlighted source in the full preview
+var (
+	hlKeywordStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("5")) // magenta
+	hlStringStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("2")) // green
+	hlNumberStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("3")) // yellow
+	hlCommentStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("8")) // gray
+)
+
+// highlightKeywords maps languages (as returned by languageForPath) to their keywords.
+// Languages without an entry are rendered plain.
+var highlightKeywords = map[string][]string{
+	"Go": {"break", "case", "chan", "const", "continue", "default", "defer", "else",
+		"fallthrough", "for", "func", "go", "goto", "if", "import", "interface", "map",
+		"package", "range", "return", "select", "struct", "switch", "type", "var",
+		"nil", "true", "false"},
+	"JavaScript": {"async", "await", "break", "case", "catch", "class", "const", "continue",
+		"default", "delete", "do", "else", "export", "extends", "finally", "for", "from",
+		"function", "if", "import", "in", "instanceof", "let", "new", "of", "return",
+		"switch", "this", "throw", "try", "typeof", "var", "while", "yield",
+		"null", "undefined", "true", "false"},
+	"TypeScript": {"async", "await", "break", "case", "catch", "class", "const", "continue",
+		"default", "do", "else", "enum", "export", "extends", "finally", "for", "from",
+		"function", "if", "implements", "import", "in", "interface", "let", "new", "of",
+		"private", "public", "readonly", "return", "switch", "this", "throw", "try",
+		"type", "typeof", "var", "while", "null", "undefined", "true", "false"},
+	"Python": {"and", "as", "assert", "async", "await", "break", "class", "continue",
+		"def", "del", "elif", "else", "except", "finally", "for", "from", "if", "import",
+		"in", "is", "lambda", "not", "or", "pass", "raise", "return", "try", "while",
+		"with", "yield", "None", "True", "False", "self"},
+	"Rust": {"as", "break", "const", "continue", "crate", "else", "enum", "fn", "for",
+		"if", "impl", "in", "let", "loop", "match", "mod", "move", "mut", "pub", "ref",
+		"return", "self", "Self", "static", "struct", "trait", "type", "use", "where",
+		"while", "true", "false"},
+	"Shell": {"case", "do", "done", "elif", "else", "esac", "export", "fi", "for",
+		"function", "if", "in", "local", "return", "then", "while"},
+}
+
+// keywordSets holds highlightKeywords as sets, built on first use
+var keywordSets map[string]map[string]bool
+
+// highlightLine colors comments, strings, numbers and keywords in one line of
+// source. It works line by line, so multi-line strings and block comments are
+// not recognised. Unknown languages are returned unchanged.
+func highlightLine(line string, lang string) string {
+	if keywordSets == nil {
+		keywordSets = make(map[string]map[string]bool, len(highlightKeywords))
+		for l, words := range highlightKeywords {
+			set := make(map[string]bool, len(words))
+			for _, w := range words {
+				set[w] = true
+			}
+			keywordSets[l] = set
+		}
+	}
+	keywords, ok := keywordSets[lang]
+	if !ok {
+		return line
+	}
+	comment := lineCommentPrefixes[lang]
+
+	var sb strings.Builder
+	for i := 0; i < len(line); {
+		c := line[i]
+		switch {
+		case comment != "" && strings.HasPrefix(line[i:], comment):
+			sb.WriteString(hlCommentStyle.Render(line[i:]))
+			return sb.String()
+
+		case c == '"' || c == '\'' || c == '`':
+			// String literal up to the matching quote (or end of line)
+			j := i + 1
+			for j < len(line) && line[j] != c {
+				if line[j] == '\\' && c != '`' {
+					j++
+				}
+				j++
+			}
+			j = min(j+1, len(line))
+			sb.WriteString(hlStringStyle.Render(line[i:j]))
+			i = j
+
+		case isIdentStart(c):
+			j := i + 1
+			for j < len(line) && (isIdentStart(line[j]) || isDigit(line[j])) {
+				j++
+			}
+			word := line[i:j]
+			if keywords[word] {
+				sb.WriteString(hlKeywordStyle.Render(word))
+			} else {
+				sb.WriteString(word)
+			}
+			i = j
+
+		case isDigit(c):
+			j := i + 1
+			for j < len(line) && (isDigit(line[j]) || line[j] == '.' || line[j] == '_' || line[j] == 'x') {
+				j++
+			}
+			sb.WriteString(hlNumberStyle.Render(line[i:j]))
+			i = j
+
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+	return sb.String()
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -12,13 +19,39 @@ import (
 
 const maxHistoryEntries = 100
 
+// historyJSONLSlack is how many lines of history.jsonl may be due for pruning
+// before the file is rewritten, so appends don't rewrite it every time
+const historyJSONLSlack = maxHistoryEntries / 10
+
+// historyJSONLMu serializes changes to history.jsonl: the yank goroutine appends
+// while the UI may rewrite it (pinning), and a line appended between a rewrite's
+// read and rename would be lost
+var historyJSONLMu sync.Mutex
+
+// History storage formats (Config.HistoryFormat)
+const (
+	historyYAMLFiles = "yaml-files" // one YAML file per entry (default)
+	historyJSONL     = "jsonl"      // one JSON object per line in history.jsonl
+)
+
+// historyJSONLName is the file jsonl-format entries are appended to
+const historyJSONLName = "history.jsonl"
+
 // HistoryEntry represents a saved prompt in history
 type HistoryEntry struct {
-	Timestamp      time.Time `yaml:"timestamp"`
-	ContextName    string    `yaml:"context_name"`
-	ProjectContext string    `yaml:"project_context"`
-	Request        string    `yaml:"request"`
-	Files          []string  `yaml:"files"`
+	Timestamp      time.Time         `yaml:"timestamp" json:"timestamp"`
+	ContextName    string            `yaml:"context_name" json:"context_name"`
+	ProjectContext string            `yaml:"project_context" json:"project_context"`
+	Request        string            `yaml:"request" json:"request"`
+	Files          []string          `yaml:"files" json:"files"`                                       // files the prompt contained
+	DisabledFiles  []string          `yaml:"disabled_files,omitempty" json:"disabled_files,omitempty"` // files in the context but disabled at yank time
+	Notes          map[string]string `yaml:"notes,omitempty" json:"notes,omitempty"`                   // per-file notes at yank time
+	FileCount      int               `yaml:"file_count,omitempty" json:"file_count,omitempty"`
+	TotalBytes     int64             `yaml:"total_bytes,omitempty" json:"total_bytes,omitempty"`           // size of the yanked prompt
+	EstTokens      int               `yaml:"estimated_tokens,omitempty" json:"estimated_tokens,omitempty"` // rough token estimate of the prompt
+	Pinned         bool              `yaml:"pinned,omitempty" json:"pinned,omitempty"`                     // pinned entries are exempt from pruning
+
+	Filename string `yaml:"-" json:"-"` // file the entry was loaded from (history.jsonl for jsonl entries)
 }
 
 // HistoryDir returns the path to ~/.ctx/history/
@@ -39,8 +72,10 @@ func EnsureHistoryDir() error {
 	return os.MkdirAll(dir, 0755)
 }
 
-// SaveHistoryEntry saves a new history entry and prunes old entries if needed
-func SaveHistoryEntry(entry HistoryEntry) error {
+// SaveHistoryEntry saves a new history entry in the configured format and prunes
+// old entries if needed. YAML files are gzip-compressed (.yaml.gz) with
+// compress_history; in jsonl format the entry is appended to history.jsonl.
+func SaveHistoryEntry(entry HistoryEntry, cfg Config) error {
 	if err := EnsureHistoryDir(); err != nil {
 		return err
 	}
@@ -50,20 +85,61 @@ func SaveHistoryEntry(entry HistoryEntry) error {
 		return err
 	}
 
+	if cfg.HistoryFormat == historyJSONL {
+		return appendHistoryJSONL(dir, entry)
+	}
+
 	// Generate filename: 2025-01-15_14-30-45_contextname.yaml
-	filename := entry.Timestamp.Format("2006-01-02_15-04-05") + "_" + sanitizeFilename(entry.ContextName) + ".yaml"
+	filename := uniqueHistoryFilename(dir, HistoryEntryFilename(entry))
+	if cfg.CompressHistory {
+		filename += ".gz"
+	}
 
-	data, err := yaml.Marshal(entry)
+	if err := writeHistoryFile(filepath.Join(dir, filename), entry); err != nil {
+		return err
+	}
+
+	// Prune old entries
+	return PruneHistory()
+}
+
+// UpdateHistoryEntry rewrites an existing history entry in place (keeping its compression)
+func UpdateHistoryEntry(entry HistoryEntry) error {
+	if entry.Filename == "" {
+		return fmt.Errorf("history entry has no file")
+	}
+
+	dir, err := HistoryDir()
 	if err != nil {
 		return err
 	}
 
-	if err := os.WriteFile(filepath.Join(dir, filename), data, 0600); err != nil {
+	if entry.Filename == historyJSONLName {
+		return updateHistoryJSONL(dir, entry)
+	}
+	return writeHistoryFile(filepath.Join(dir, entry.Filename), entry)
+}
+
+// writeHistoryFile marshals an entry to path, gzip-compressing it if path ends in .gz
+func writeHistoryFile(path string, entry HistoryEntry) error {
+	data, err := yaml.Marshal(entry)
+	if err != nil {
 		return err
 	}
 
-	// Prune old entries
-	return PruneHistory()
+	if strings.HasSuffix(path, ".gz") {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	}
+
+	return os.WriteFile(path, data, 0600)
 }
 
 // ListHistoryEntries returns all history entries sorted by timestamp (newest first)
@@ -85,7 +161,7 @@ func ListHistoryEntries() ([]HistoryEntry, error) {
 
 	var historyEntries []HistoryEntry
 	for _, e := range entries {
-		if e.IsDir() || !strings.HasSuffix(e.Name(), ".yaml") {
+		if e.IsDir() || !isHistoryFile(e.Name()) {
 			continue
 		}
 
@@ -96,14 +172,53 @@ func ListHistoryEntries() ([]HistoryEntry, error) {
 		historyEntries = append(historyEntries, entry)
 	}
 
-	// Sort by timestamp descending (newest first)
+	// Entries from history.jsonl are listed alongside the files, whichever format is active
+	lines, err := readHistoryJSONL(dir)
+	if err != nil {
+		return nil, err
+	}
+	historyEntries = append(historyEntries, lines...)
+
+	// Sort by timestamp descending (newest first); same-second entries by filename
 	sort.Slice(historyEntries, func(i, j int) bool {
-		return historyEntries[i].Timestamp.After(historyEntries[j].Timestamp)
+		a, b := historyEntries[i], historyEntries[j]
+		if !a.Timestamp.Equal(b.Timestamp) {
+			return a.Timestamp.After(b.Timestamp)
+		}
+		return a.Filename > b.Filename
 	})
 
 	return historyEntries, nil
 }
 
+// historyExport is the document written by ExportHistory
+type historyExport struct {
+	ExportedAt time.Time      `yaml:"exported_at" json:"exported_at"`
+	Entries    []HistoryEntry `yaml:"entries" json:"entries"`
+}
+
+// ExportHistory serializes every history entry (newest first) into one YAML or
+// JSON document. Returns the document and the number of entries.
+func ExportHistory(asJSON bool) ([]byte, int, error) {
+	entries, err := ListHistoryEntries()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	doc := historyExport{ExportedAt: time.Now(), Entries: entries}
+	var data []byte
+	if asJSON {
+		data, err = json.MarshalIndent(doc, "", "  ")
+		data = append(data, '\n')
+	} else {
+		data, err = yaml.Marshal(doc)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, len(entries), nil
+}
+
 // LoadHistoryEntry loads a history entry by filename
 func LoadHistoryEntry(filename string) (HistoryEntry, error) {
 	dir, err := HistoryDir()
@@ -116,50 +231,172 @@ func LoadHistoryEntry(filename string) (HistoryEntry, error) {
 		return HistoryEntry{}, err
 	}
 
+	// Transparently decompress gzipped entries
+	if strings.HasSuffix(filename, ".gz") {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return HistoryEntry{}, err
+		}
+		defer zr.Close()
+		data, err = io.ReadAll(zr)
+		if err != nil {
+			return HistoryEntry{}, err
+		}
+	}
+
 	var entry HistoryEntry
 	if err := yaml.Unmarshal(data, &entry); err != nil {
 		return HistoryEntry{}, err
 	}
+	entry.Filename = filename
 
 	return entry, nil
 }
 
-// PruneHistory removes oldest entries if there are more than maxHistoryEntries
+// PruneHistory removes the oldest entries if there are more than maxHistoryEntries,
+// counting entry files and history.jsonl lines together. Pinned entries are never
+// deleted. Files go right away; history.jsonl is only rewritten once at least
+// historyJSONLSlack of its lines are due.
 func PruneHistory() error {
+	historyJSONLMu.Lock()
+	defer historyJSONLMu.Unlock()
+
 	dir, err := HistoryDir()
 	if err != nil {
 		return err
 	}
 
-	entries, err := os.ReadDir(dir)
-	if err != nil {
+	entries, err := ListHistoryEntries()
+	if err != nil || len(entries) <= maxHistoryEntries {
 		return err
 	}
 
-	// Filter to only yaml files
-	var yamlFiles []os.DirEntry
-	for _, e := range entries {
-		if !e.IsDir() && strings.HasSuffix(e.Name(), ".yaml") {
-			yamlFiles = append(yamlFiles, e)
+	// Delete oldest unpinned entries (entries is newest first)
+	toDelete := len(entries) - maxHistoryEntries
+	var dueLines []HistoryEntry
+	for i := len(entries) - 1; i >= 0 && toDelete > 0; i-- {
+		entry := entries[i]
+		if entry.Pinned {
+			continue
 		}
+		if entry.Filename == historyJSONLName {
+			dueLines = append(dueLines, entry)
+		} else {
+			os.Remove(filepath.Join(dir, entry.Filename))
+		}
+		toDelete--
 	}
 
-	if len(yamlFiles) <= maxHistoryEntries {
+	if len(dueLines) < historyJSONLSlack {
 		return nil
 	}
+	lines, err := readHistoryJSONL(dir)
+	if err != nil {
+		return err
+	}
+	kept := lines[:0]
+	for _, line := range lines {
+		if !slices.ContainsFunc(dueLines, line.sameEntry) {
+			kept = append(kept, line)
+		}
+	}
+	return writeHistoryJSONL(dir, kept)
+}
 
-	// Sort by name (which includes timestamp, so oldest first)
-	sort.Slice(yamlFiles, func(i, j int) bool {
-		return yamlFiles[i].Name() < yamlFiles[j].Name()
-	})
+// sameEntry reports whether e and other are the same history.jsonl line, which
+// have no filename of their own: matched by timestamp and context name
+func (e HistoryEntry) sameEntry(other HistoryEntry) bool {
+	return e.Timestamp.Equal(other.Timestamp) && e.ContextName == other.ContextName
+}
+
+// appendHistoryJSONL appends entry as one line to history.jsonl in dir and prunes history
+func appendHistoryJSONL(dir string, entry HistoryEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	historyJSONLMu.Lock()
+	f, err := os.OpenFile(filepath.Join(dir, historyJSONLName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err == nil {
+		_, err = f.Write(append(line, '\n'))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	historyJSONLMu.Unlock()
+	if err != nil {
+		return err
+	}
 
-	// Delete oldest entries
-	toDelete := len(yamlFiles) - maxHistoryEntries
-	for i := 0; i < toDelete; i++ {
-		os.Remove(filepath.Join(dir, yamlFiles[i].Name()))
+	return PruneHistory()
+}
+
+// readHistoryJSONL parses history.jsonl in dir, oldest first. Malformed lines are
+// skipped; a missing file has no entries.
+func readHistoryJSONL(dir string) ([]HistoryEntry, error) {
+	data, err := os.ReadFile(filepath.Join(dir, historyJSONLName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	var entries []HistoryEntry
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var entry HistoryEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			continue // Skip malformed lines
+		}
+		entry.Filename = historyJSONLName
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// writeHistoryJSONL replaces history.jsonl in dir with entries, one per line. The
+// caller holds historyJSONLMu.
+func writeHistoryJSONL(dir string, entries []HistoryEntry) error {
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	// Write a temp file and rename it, so a crash can't leave a half-written history
+	path := filepath.Join(dir, historyJSONLName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// updateHistoryJSONL rewrites the line of history.jsonl holding entry (matched by
+// timestamp and context name)
+func updateHistoryJSONL(dir string, entry HistoryEntry) error {
+	historyJSONLMu.Lock()
+	defer historyJSONLMu.Unlock()
+
+	entries, err := readHistoryJSONL(dir)
+	if err != nil {
+		return err
+	}
+	for i, e := range entries {
+		if e.sameEntry(entry) {
+			entries[i] = entry
+			return writeHistoryJSONL(dir, entries)
+		}
+	}
+	return fmt.Errorf("history entry not found in %s", historyJSONLName)
 }
 
 // HistoryEntryFilename returns the filename for a history entry
@@ -167,6 +404,36 @@ func HistoryEntryFilename(entry HistoryEntry) string {
 	return entry.Timestamp.Format("2006-01-02_15-04-05") + "_" + sanitizeFilename(entry.ContextName) + ".yaml"
 }
 
+// uniqueHistoryFilename appends a counter (_002, _003, ...) before the extension if an
+// entry with the same name (compressed or not) already exists in dir. The counter is
+// zero-padded so names sort in save order.
+func uniqueHistoryFilename(dir string, filename string) string {
+	exists := func(name string) bool {
+		for _, n := range []string{name, name + ".gz"} {
+			if _, err := os.Stat(filepath.Join(dir, n)); err == nil {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !exists(filename) {
+		return filename
+	}
+	base := strings.TrimSuffix(filename, ".yaml")
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s_%03d.yaml", base, n)
+		if !exists(candidate) {
+			return candidate
+		}
+	}
+}
+
+// isHistoryFile reports whether a filename is a (possibly compressed) history entry
+func isHistoryFile(name string) bool {
+	return strings.HasSuffix(name, ".yaml") || strings.HasSuffix(name, ".yaml.gz")
+}
+
 // sanitizeFilename removes/replaces characters that aren't safe for filenames
 func sanitizeFilename(name string) string {
 	// Replace unsafe characters with underscore
@@ -199,7 +466,148 @@ func (e HistoryEntry) RequestPreview() string {
 	return preview
 }
 
-// FormatTimestamp returns a human-readable timestamp
-func (e HistoryEntry) FormatTimestamp() string {
-	return e.Timestamp.Format("2006-01-02 15:04")
+// SizeSummary returns a short description of the prompt size, or "" for entries saved without stats
+func (e HistoryEntry) SizeSummary() string {
+	if e.TotalBytes == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d files, %s, ~%s tokens", e.FileCount, formatSize(e.TotalBytes), formatTokens(e.EstTokens))
+}
+
+// defaultHistoryTimeFormat is the history timestamp layout when history_time_format is unset
+const defaultHistoryTimeFormat = "2006-01-02 15:04"
+
+// FormatTimestamp returns a human-readable timestamp: relative ("3d ago") when
+// history_relative_time is set, otherwise in the history_time_format layout
+func (e HistoryEntry) FormatTimestamp(cfg Config) string {
+	if cfg.HistoryRelativeTime {
+		return relativeTime(e.Timestamp, time.Now())
+	}
+	layout := cfg.HistoryTimeFormat
+	if layout == "" {
+		layout = defaultHistoryTimeFormat
+	}
+	return e.Timestamp.Format(layout)
+}
+
+// relativeTime describes how long before now t was, in the largest whole unit
+func relativeTime(t, now time.Time) string {
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d/time.Hour))
+	case d < 30*24*time.Hour:
+		return fmt.Sprintf("%dd ago", int(d/(24*time.Hour)))
+	case d < 365*24*time.Hour:
+		return fmt.Sprintf("%dmo ago", int(d/(30*24*time.Hour)))
+	default:
+		return fmt.Sprintf("%dy ago", int(d/(365*24*time.Hour)))
+	}
+}
+
+// diffHistory returns a line diff between two history entries: a unified diff of
+// the Request text followed by the added/removed file paths (a is the base)
+func diffHistory(a, b HistoryEntry) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("--- %s  %s\n", a.Timestamp.Format(defaultHistoryTimeFormat), a.ContextName))
+	sb.WriteString(fmt.Sprintf("+++ %s  %s\n", b.Timestamp.Format(defaultHistoryTimeFormat), b.ContextName))
+	sb.WriteString("\n")
+
+	// Request diff
+	sb.WriteString("Request:\n")
+	if a.Request == b.Request {
+		sb.WriteString("  (unchanged)\n")
+	} else {
+		for _, line := range diffLines(splitLines(a.Request), splitLines(b.Request)) {
+			sb.WriteString(line)
+			sb.WriteString("\n")
+		}
+	}
+	sb.WriteString("\n")
+
+	// Files diff
+	sb.WriteString("Files:\n")
+	inA := make(map[string]bool)
+	for _, f := range a.Files {
+		inA[f] = true
+	}
+	inB := make(map[string]bool)
+	for _, f := range b.Files {
+		inB[f] = true
+	}
+	changed := false
+	for _, f := range a.Files {
+		if !inB[f] {
+			sb.WriteString("- " + f + "\n")
+			changed = true
+		}
+	}
+	for _, f := range b.Files {
+		if !inA[f] {
+			sb.WriteString("+ " + f + "\n")
+			changed = true
+		}
+	}
+	if !changed {
+		sb.WriteString("  (unchanged)\n")
+	}
+
+	return sb.String()
+}
+
+// splitLines splits text into lines, ignoring a single trailing newline
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines returns a line-based diff of a and b using the longest common
+// subsequence. Lines are prefixed with "  ", "- " or "+ ".
+func diffLines(a, b []string) []string {
+	// lcs[i][j] = length of LCS of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out []string
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, "  "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, "- "+a[i])
+			i++
+		default:
+			out = append(out, "+ "+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		out = append(out, "- "+a[i])
+	}
+	for ; j < len(b); j++ {
+		out = append(out, "+ "+b[j])
+	}
+
+	return out
 }
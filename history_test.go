@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveHistoryEntry(t *testing.T) {
+	tempConfigDir(t)
+
+	when := time.Date(2025, 1, 15, 14, 30, 45, 0, time.Local)
+	for _, cfg := range []Config{{}, {CompressHistory: true}, {HistoryFormat: historyJSONL}} {
+		entry := HistoryEntry{Timestamp: when, ContextName: "api", Request: "Fix it", Files: []string{"/a.go"}}
+		if err := SaveHistoryEntry(entry, cfg); err != nil {
+			t.Fatalf("SaveHistoryEntry(%+v): %v", cfg, err)
+		}
+	}
+
+	entries, err := ListHistoryEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3 (yaml, yaml.gz and jsonl)", len(entries))
+	}
+	for _, e := range entries {
+		if e.ContextName != "api" || e.Request != "Fix it" || !e.Timestamp.Equal(when) {
+			t.Errorf("entry %s = %+v", e.Filename, e)
+		}
+	}
+}
+
+func TestPruneHistory(t *testing.T) {
+	tempConfigDir(t)
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local)
+	for i := range maxHistoryEntries + 5 {
+		entry := HistoryEntry{
+			Timestamp:   start.Add(time.Duration(i) * time.Minute),
+			ContextName: "api",
+			Pinned:      i == 0, // the oldest entry survives pruning
+		}
+		if err := SaveHistoryEntry(entry, Config{}); err != nil {
+			t.Fatalf("SaveHistoryEntry: %v", err)
+		}
+	}
+
+	dir, err := HistoryDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != maxHistoryEntries {
+		t.Errorf("%d history files left, want %d", len(files), maxHistoryEntries)
+	}
+
+	entries, err := ListHistoryEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldest := entries[len(entries)-1]
+	if !oldest.Pinned || !oldest.Timestamp.Equal(start) {
+		t.Errorf("oldest entry = %+v, want the pinned first one", oldest)
+	}
+	if second := entries[len(entries)-2]; !second.Timestamp.Equal(start.Add(6 * time.Minute)) {
+		t.Errorf("oldest unpinned entry is from %s, want %s", second.Timestamp, start.Add(6*time.Minute))
+	}
+}
+
+func TestPruneHistoryAcrossFormats(t *testing.T) {
+	tempConfigDir(t)
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local)
+	save := func(i int, cfg Config) {
+		t.Helper()
+		entry := HistoryEntry{Timestamp: start.Add(time.Duration(i) * time.Minute), ContextName: "api"}
+		if err := SaveHistoryEntry(entry, cfg); err != nil {
+			t.Fatalf("SaveHistoryEntry: %v", err)
+		}
+	}
+	count := func() int {
+		t.Helper()
+		entries, err := ListHistoryEntries()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(entries)
+	}
+
+	// Files and history.jsonl share one cap; the oldest entries (files) go first
+	for i := range maxHistoryEntries - 5 {
+		save(i, Config{})
+	}
+	jsonl := Config{HistoryFormat: historyJSONL}
+	for i := range 10 {
+		save(maxHistoryEntries+i, jsonl)
+	}
+	if n := count(); n != maxHistoryEntries {
+		t.Errorf("%d entries after mixing formats, want %d", n, maxHistoryEntries)
+	}
+
+	// Only jsonl lines left to prune: the file is rewritten once enough are due
+	dir, _ := HistoryDir()
+	files, _ := os.ReadDir(dir)
+	for _, f := range files {
+		if f.Name() != historyJSONLName {
+			os.Remove(filepath.Join(dir, f.Name()))
+		}
+	}
+	for i := range maxHistoryEntries + historyJSONLSlack - 1 {
+		save(2*maxHistoryEntries+i, jsonl)
+	}
+	if n := count(); n != maxHistoryEntries+historyJSONLSlack-1 {
+		t.Errorf("%d entries below the slack, want %d", n, maxHistoryEntries+historyJSONLSlack-1)
+	}
+	save(4*maxHistoryEntries, jsonl)
+	if n := count(); n != maxHistoryEntries {
+		t.Errorf("%d entries after reaching the slack, want %d", n, maxHistoryEntries)
+	}
+}
+
+func TestHistoryJSONLConcurrentUpdate(t *testing.T) {
+	tempConfigDir(t)
+
+	cfg := Config{HistoryFormat: historyJSONL}
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local)
+	first := HistoryEntry{Timestamp: start, ContextName: "api"}
+	if err := SaveHistoryEntry(first, cfg); err != nil {
+		t.Fatal(err)
+	}
+	first.Filename = historyJSONLName
+
+	const appends = 20
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= appends; i++ {
+			SaveHistoryEntry(HistoryEntry{Timestamp: start.Add(time.Duration(i) * time.Minute), ContextName: "api"}, cfg)
+		}
+	}()
+	for i := range appends {
+		first.Pinned = i%2 == 0
+		if err := UpdateHistoryEntry(first); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+
+	entries, err := ListHistoryEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != appends+1 {
+		t.Errorf("%d entries, want %d (lines lost to a concurrent rewrite)", len(entries), appends+1)
+	}
+}
+
+func TestUniqueHistoryFilenameOrder(t *testing.T) {
+	tempConfigDir(t)
+
+	when := time.Date(2025, 1, 15, 14, 30, 45, 0, time.Local)
+	for i := range 12 {
+		entry := HistoryEntry{Timestamp: when, ContextName: "api", Request: fmt.Sprint(i)}
+		if err := SaveHistoryEntry(entry, Config{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Same-second entries are listed newest first, the last one saved on top
+	entries, err := ListHistoryEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range entries {
+		if want := fmt.Sprint(11 - i); e.Request != want {
+			t.Errorf("entry %d (%s) has request %s, want %s", i, e.Filename, e.Request, want)
+		}
+	}
+}
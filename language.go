@@ -0,0 +1,149 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// languagesByExt maps lowercase file extensions to a language name
+var languagesByExt = map[string]string{
+	".go":     "Go",
+	".js":     "JavaScript",
+	".jsx":    "JavaScript",
+	".mjs":    "JavaScript",
+	".cjs":    "JavaScript",
+	".ts":     "TypeScript",
+	".tsx":    "TypeScript",
+	".py":     "Python",
+	".rb":     "Ruby",
+	".rs":     "Rust",
+	".java":   "Java",
+	".kt":     "Kotlin",
+	".swift":  "Swift",
+	".c":      "C",
+	".h":      "C",
+	".cc":     "C++",
+	".cpp":    "C++",
+	".hpp":    "C++",
+	".cs":     "C#",
+	".php":    "PHP",
+	".lua":    "Lua",
+	".sh":     "Shell",
+	".bash":   "Shell",
+	".zsh":    "Shell",
+	".sql":    "SQL",
+	".html":   "HTML",
+	".htm":    "HTML",
+	".css":    "CSS",
+	".scss":   "SCSS",
+	".vue":    "Vue",
+	".svelte": "Svelte",
+	".json":   "JSON",
+	".yaml":   "YAML",
+	".yml":    "YAML",
+	".toml":   "TOML",
+	".xml":    "XML",
+	".md":     "Markdown",
+	".txt":    "Text",
+}
+
+// languagesByName maps well-known extensionless filenames to a language name
+var languagesByName = map[string]string{
+	"Makefile":   "Makefile",
+	"Dockerfile": "Dockerfile",
+	"go.mod":     "Go Module",
+	"go.sum":     "Go Module",
+}
+
+// languageTags maps language names to the short tag shown in the files list
+var languageTags = map[string]string{
+	"Go":         "go",
+	"Go Module":  "mod",
+	"JavaScript": "js",
+	"TypeScript": "ts",
+	"Python":     "py",
+	"Ruby":       "rb",
+	"Rust":       "rs",
+	"Java":       "java",
+	"Kotlin":     "kt",
+	"Swift":      "swft",
+	"C":          "c",
+	"C++":        "c++",
+	"C#":         "c#",
+	"PHP":        "php",
+	"Lua":        "lua",
+	"Shell":      "sh",
+	"SQL":        "sql",
+	"HTML":       "html",
+	"CSS":        "css",
+	"SCSS":       "scss",
+	"Vue":        "vue",
+	"Svelte":     "svlt",
+	"JSON":       "json",
+	"YAML":       "yaml",
+	"TOML":       "toml",
+	"XML":        "xml",
+	"Markdown":   "md",
+	"Text":       "txt",
+	"Makefile":   "make",
+	"Dockerfile": "dock",
+}
+
+// languageIcons maps language names to Nerd Font icons (used with file_icons: true)
+var languageIcons = map[string]string{
+	"Go":         "\ue627",
+	"Go Module":  "\ue627",
+	"JavaScript": "\ue74e",
+	"TypeScript": "\ue628",
+	"Python":     "\ue73c",
+	"Ruby":       "\ue739",
+	"Rust":       "\ue7a8",
+	"Java":       "\ue738",
+	"C":          "\ue61e",
+	"C++":        "\ue61d",
+	"PHP":        "\ue73d",
+	"Lua":        "\ue620",
+	"Shell":      "\ue795",
+	"HTML":       "\ue736",
+	"CSS":        "\ue749",
+	"Vue":        "\ue6a0",
+	"JSON":       "\ue60b",
+	"Markdown":   "\ue609",
+	"Dockerfile": "\ue7b0",
+}
+
+// fileTagWidth is the width of the type tag column in the files list
+const fileTagWidth = 4
+
+// fileTag returns a short type tag for path: a Nerd Font icon if icons is set
+// and one is known, otherwise an ASCII tag of at most fileTagWidth characters
+// (falling back to the extension)
+func fileTag(path string, icons bool) string {
+	lang := languageForPath(path)
+	if icons {
+		if icon, ok := languageIcons[lang]; ok {
+			return icon
+		}
+	}
+	if tag, ok := languageTags[lang]; ok {
+		return tag
+	}
+
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	if len(ext) > fileTagWidth {
+		ext = ext[:fileTagWidth]
+	}
+	return ext
+}
+
+// languageForPath returns the language of a file based on its name, or "Other"
+func languageForPath(path string) string {
+	base := filepath.Base(path)
+	if lang, ok := languagesByName[base]; ok {
+		return lang
+	}
+	if lang, ok := languagesByExt[strings.ToLower(filepath.Ext(base))]; ok {
+		return lang
+	}
+	return "Other"
+}
@@ -1,16 +1,24 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
+	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textarea"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
 )
 
 // UI modes
@@ -24,8 +32,26 @@ const (
 	modeNewContext
 	modeAddFile
 	modeShowConfig
-	modeEditBox          // editing Request or Project Context
-	modeConfirmDeleteCtx // confirming context deletion
+	modeEditBox     // editing Request or Project Context
+	modeConfirm     // yes/no confirmation prompt
+	modeHistoryDiff // viewing a diff between two history entries
+	modeCommand     // command palette
+	modeHelp        // keybindings overlay
+	modeStats       // size/line statistics by language
+	modeBackupSelect
+	modeExcludeTest       // entering a directory to test the exclude rule against
+	modeExcludeTestResult // included/excluded files for the tested directory
+	modeEditPath          // editing the path of the cursor file
+	modeContextFromFile   // entering a markdown file (and #section) for the project context
+	modeProjectRoot       // editing the context's project root
+	modeContextSizes      // all contexts ranked by total size
+	modeAddDirList        // entering a file listing directories to add
+	modeEditNote          // editing the note of the cursor file
+	modeTemplateSelect    // picking a template for a new context
+	modeFullPreview       // scrolling through the full prompt
+	modeExportHistory     // entering a path to export all history to
+	modeAudit             // report of files shared across contexts and missing files
+	modeSkipPrefixes      // editing skip_prefixes, with a preview of the project names
 )
 
 // Tab constants for main view
@@ -42,8 +68,14 @@ type FileInfo struct {
 	Project  string
 	RelPath  string
 	Size     int64
+	Lines    int // 0 for binary or missing files
 	Exists   bool
 	Selected bool
+	Changed  bool // modified (or added) since the last yank
+	Symlink  bool // Size is the resolved target's size
+	Oversize bool // symlink whose target exceeds the exclude rule's max_bytes; skipped when yanking
+	Pinned   bool // listed (and yanked) before unpinned files
+	Disabled bool // kept in the list but left out of yanks
 }
 
 // FolderInfo holds aggregated info for a folder
@@ -67,7 +99,11 @@ type Model struct {
 	context     Context
 	contexts    []string // list of all context names
 	exclude     ExcludeRule
-	files       []FileInfo
+	cache        *fileCache // file contents for repeated yanks
+	boxes        *boxCache  // rendered Request/Project Context boxes
+	files        []FileInfo // displayed files: allFiles, or only the missing ones
+	allFiles     []FileInfo
+	missingOnly  bool // view filter: list only files that don't exist
 	folders     []FolderInfo
 	cursor      int
 	offset      int // scroll offset
@@ -80,31 +116,95 @@ type Model struct {
 	// For context/exclude selection
 	selectItems  []string
 	selectCursor int
+	selectMarked map[string]bool  // contexts marked for batch delete
+	selectFilter string           // type-to-filter query (context and exclude pickers)
+	selectBroken map[string]error // contexts in the picker that can't be loaded
 
 	// For editing text boxes
 	textArea    textarea.Model
-	editingBox  int // which box is being edited (-1 = none)
+	editingBox int  // which box is being edited (-1 = none)
+	dirty      bool // textarea content differs from the stored value
 
-	// For delete confirmation
-	deleteTarget string // context name to delete
+	// For yes/no confirmation
+	confirm confirmPrompt
 
 	// Main view tab (context or history)
 	activeTab      mainTab
 	historyEntries []HistoryEntry
 	historyCursor  int
 	historyOffset  int
+	historyBase    int // entry marked as diff base (-1 = none)
+
+	historyOldestFirst bool // history list shown in chronological order
+
+	// For history diff view
+	diffLines  []string
+	diffOffset int
+
+	// For the full preview: prompt lines and the language of each (""
+	// outside file contents)
+	pagerLines  []string
+	pagerLangs  []string
+	pagerOffset int
+
+	// For the context audit report (also used for the compaction summary)
+	auditTitle  string
+	auditLines  []string
+	auditOffset int
+
+	// Mode to return to when the help overlay closes
+	helpReturnMode mode
+
+	// For the context size leaderboard
+	contextSizes []ContextSize
+
+	// Previously active contexts, most recent last (for ctrl+o)
+	contextHistory []string
+
+	// Pending numeric jump in the Files box (digits typed so far)
+	countBuffer string
+
+	// Result of the last exclude rule test
+	excludeTest ExcludeTestResult
+
+	// File whose path or note is being edited
+	editPathOrig string
+
+	// Name of the context being created while its template is picked
+	newContextName string
+
+	// Status line message (cleared on the next key press)
+	status string
+
+	// Last failed operation in full, copied with ctrl+e (the status line clips it)
+	lastError *errorReport
+
+	// Background yank progress
+	yanking   bool
+	yankDone  int
+	yankTotal int
+	spinner   spinner.Model
+
+	// Quit once the current yank has been copied
+	quitAfterYank bool
 
 	// Terminal size
 	width  int
 	height int
 }
 
-func initialModel() Model {
+// initialModel loads the config and the active context, or the context stored in
+// contextFile if set
+func initialModel(contextFile string) Model {
 	m := Model{
-		mode:       modeNormal,
-		width:      80,
-		height:     24,
-		editingBox: -1,
+		mode:        modeNormal,
+		width:       80,
+		height:      24,
+		editingBox:  -1,
+		historyBase: -1,
+		cache:       newFileCache(maxCacheBytes),
+		boxes:       newBoxCache(),
+		spinner:     spinner.New(spinner.WithSpinner(spinner.Dot)),
 	}
 
 	// Ensure config directory exists
@@ -122,27 +222,40 @@ func initialModel() Model {
 	m.config = cfg
 
 	// Load active context (fall back to "default" if not found)
-	ctx, err := LoadContext(cfg.ActiveContext)
-	if err != nil {
-		// Try loading default context instead
-		ctx, err = LoadContext("default")
+	var ctx Context
+	if contextFile != "" {
+		ctx, err = LoadContextFromPath(contextFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading context file: %v\n", err)
+			os.Exit(1)
+		}
+	} else if ctx, err = LoadContext(cfg.ActiveContext); err != nil {
+		// Fall back to default (or any context that loads) and say why
+		loadErr := err
+		ctx, err = LoadFallbackContext()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error loading context: %v\n", err)
 			os.Exit(1)
 		}
-		// Update config to use default
-		cfg.ActiveContext = "default"
+		if !errors.Is(loadErr, os.ErrNotExist) {
+			m.recordError(fmt.Sprintf("Couldn't load context %s, opened %s: %v", cfg.ActiveContext, ctx.Name, loadErr), loadErr)
+		}
+		cfg.ActiveContext = ctx.Name
 		SaveConfig(cfg)
 	}
 	m.context = ctx
 
-	// Load active exclude rule
-	exc, err := LoadExcludeRule(cfg.ActiveExclude)
-	if err != nil {
+	// Point out broken contexts so they can be fixed
+	if broken := UnloadableContexts(); len(broken) > 0 && m.status == "" {
+		names := slices.Sorted(maps.Keys(broken))
+		m.status = fmt.Sprintf("%d contexts can't be loaded: %s (details: audit contexts)", len(names), strings.Join(names, ", "))
+	}
+
+	// Load effective exclude rule (context override or global)
+	if err := m.refreshExclude(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading exclude: %v\n", err)
 		os.Exit(1)
 	}
-	m.exclude = exc
 
 	// Load list of all contexts
 	contexts, err := ListContexts()
@@ -155,28 +268,174 @@ func initialModel() Model {
 	// Build file info list
 	m.refreshFiles()
 
+	if cfg.RestoreSession {
+		m.restoreSession()
+	}
+
 	return m
 }
 
+// restoreSession restores the tab, cursor and active box saved on the last quit
+func (m *Model) restoreSession() {
+	sess, err := LoadSession()
+	if err != nil {
+		return
+	}
+
+	if sess.ActiveBox >= boxRequest && sess.ActiveBox <= boxProjectContext {
+		m.activeBox = sess.ActiveBox
+	}
+
+	// Guard against a stale cursor if the file list changed
+	m.cursor = max(min(sess.Cursor, len(m.files)-1), 0)
+	if visibleRows := m.visibleFileRows(); m.cursor >= visibleRows {
+		m.offset = m.cursor - visibleRows + 1
+	}
+
+	if sess.ActiveTab == tabHistory {
+		m.activeTab = tabHistory
+		m.loadHistoryEntries()
+	}
+}
+
+// quit saves the session (if enabled) and exits
+func (m Model) quit() (tea.Model, tea.Cmd) {
+	if m.config.RestoreSession {
+		SaveSession(Session{
+			ActiveTab: m.activeTab,
+			Cursor:    m.cursor,
+			ActiveBox: m.activeBox,
+		})
+	}
+	return m, tea.Quit
+}
+
 func (m *Model) refreshFiles() {
-	m.files = make([]FileInfo, len(m.context.Files))
+	m.allFiles = make([]FileInfo, len(m.context.Files))
 	for i, path := range m.context.Files {
-		m.files[i] = m.buildFileInfo(path)
+		m.allFiles[i] = m.buildFileInfo(path)
+	}
+
+	sortFiles(m.allFiles, m.config.SortMode)
+	m.files = m.allFiles
+	if m.missingOnly {
+		m.files = nil
+		for _, f := range m.allFiles {
+			if !f.Exists {
+				m.files = append(m.files, f)
+			}
+		}
+	}
+	m.refreshFolders()
+}
+
+// toggleMissingOnly switches the file list between all files and only the missing ones
+func (m *Model) toggleMissingOnly() tea.Cmd {
+	m.missingOnly = !m.missingOnly
+	m.refreshFiles()
+	m.cursor = 0
+	m.offset = 0
+	if m.missingOnly {
+		return m.setStatus(fmt.Sprintf("Showing %d missing of %d files (! shows all)", len(m.files), len(m.allFiles)))
 	}
+	return m.setStatus("Showing all files")
+}
 
-	// Sort by size descending (largest first)
-	sort.Slice(m.files, func(i, j int) bool {
-		return m.files[i].Size > m.files[j].Size
+// sortFiles orders files by the given sort mode (custom keeps their order), then
+// moves pinned files to the front, keeping the sort order within each group
+func sortFiles(files []FileInfo, mode string) {
+	switch mode {
+	case sortCustom:
+		// Keep the stored order of the context's files
+	case sortName:
+		sort.Slice(files, func(i, j int) bool {
+			return files[i].Path < files[j].Path
+		})
+	default:
+		// Sort by size descending (largest first)
+		sort.Slice(files, func(i, j int) bool {
+			return files[i].Size > files[j].Size
+		})
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].Pinned && !files[j].Pinned
 	})
+}
 
-	m.refreshFolders()
+// File list sort modes
+const (
+	sortSize   = "size"
+	sortName   = "name"
+	sortCustom = "custom"
+)
+
+// cycleSortMode switches to the next file sort mode and saves it
+func (m *Model) cycleSortMode() tea.Cmd {
+	switch m.config.SortMode {
+	case sortName:
+		m.config.SortMode = sortCustom
+	case sortCustom:
+		m.config.SortMode = sortSize
+	default:
+		m.config.SortMode = sortName
+	}
+	SaveConfig(m.config)
+	m.refreshFiles()
+	m.cursor = 0
+	m.offset = 0
+	return m.setStatus("Sort: " + m.config.SortMode)
+}
+
+// moveCursorFile moves the file under the cursor by delta positions in the stored
+// (custom) order and saves the context
+func (m *Model) moveCursorFile(delta int) tea.Cmd {
+	if m.config.SortMode != sortCustom {
+		return m.setStatus("Switch to custom sort (o) to reorder files")
+	}
+	if m.missingOnly {
+		return m.setStatus("Show all files (!) to reorder them")
+	}
+	if m.cursor >= len(m.files) {
+		return nil
+	}
+
+	// In custom mode m.files is m.context.Files with pinned files moved to the
+	// front, so swap the stored positions of the two displayed neighbours.
+	// Files don't move across the pinned/unpinned boundary.
+	target := m.cursor + delta
+	if target < 0 || target >= len(m.files) || m.files[target].Pinned != m.files[m.cursor].Pinned {
+		return nil
+	}
+	files := m.context.Files
+	a := slices.Index(files, m.files[m.cursor].Path)
+	b := slices.Index(files, m.files[target].Path)
+	if a < 0 || b < 0 {
+		return nil
+	}
+	files[a], files[b] = files[b], files[a]
+	SaveContext(m.context)
+	m.refreshFiles()
+
+	m.cursor = target
+	visibleRows := m.visibleFileRows()
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	} else if m.cursor >= m.offset+visibleRows {
+		m.offset = m.cursor - visibleRows + 1
+	}
+	return nil
 }
 
 func (m *Model) refreshFolders() {
-	// Group files by parent directory
+	m.folders = groupFolders(m.files)
+}
+
+// groupFolders aggregates files by parent directory, sorted by path
+func groupFolders(files []FileInfo) []FolderInfo {
 	folderMap := make(map[string]*FolderInfo)
 
-	for _, f := range m.files {
+	for _, f := range files {
 		dir := filepath.Dir(f.Path)
 		if folder, exists := folderMap[dir]; exists {
 			folder.FileCount++
@@ -191,21 +450,29 @@ func (m *Model) refreshFolders() {
 	}
 
 	// Convert map to slice
-	m.folders = make([]FolderInfo, 0, len(folderMap))
+	folders := make([]FolderInfo, 0, len(folderMap))
 	for _, folder := range folderMap {
-		m.folders = append(m.folders, *folder)
+		folders = append(folders, *folder)
 	}
 
 	// Sort by path
-	sort.Slice(m.folders, func(i, j int) bool {
-		return m.folders[i].Path < m.folders[j].Path
+	sort.Slice(folders, func(i, j int) bool {
+		return folders[i].Path < folders[j].Path
 	})
+	return folders
 }
 
 func (m *Model) buildFileInfo(path string) FileInfo {
 	info := FileInfo{
-		Path:   path,
-		Exists: true,
+		Path:     path,
+		Exists:   true,
+		Pinned:   m.context.PinnedFiles[path],
+		Disabled: m.context.DisabledFiles[path],
+	}
+
+	// Symlinks are followed, but a huge target is flagged instead of being read
+	if lstat, err := os.Lstat(path); err == nil && lstat.Mode()&os.ModeSymlink != 0 {
+		info.Symlink = true
 	}
 
 	// Check if file exists and get size
@@ -215,8 +482,28 @@ func (m *Model) buildFileInfo(path string) FileInfo {
 		info.Size = 0
 	} else {
 		info.Size = stat.Size()
+		if info.Symlink && m.exclude.MaxBytes > 0 && info.Size > m.exclude.MaxBytes {
+			info.Oversize = true
+		} else if info.Size <= streamThreshold && (m.exclude.MaxBytes <= 0 || info.Size <= m.exclude.MaxBytes) {
+			// Files that would be streamed or excluded aren't read just to count lines
+			info.Lines = m.cache.CountLines(path, stat)
+		}
+
+		// Only flag changes once the context has been yanked
+		if len(m.context.YankedMtimes) > 0 {
+			yanked, ok := m.context.YankedMtimes[path]
+			info.Changed = !ok || stat.ModTime().After(yanked)
+		}
 	}
 
+	info.Project, info.RelPath = splitProject(path, m.config.SkipPrefixes)
+
+	return info
+}
+
+// splitProject splits a path into its project name (the first directory below home
+// that isn't one of skipPrefixes) and the path relative to that project
+func splitProject(path string, skipPrefixes []string) (string, string) {
 	// Build display path
 	home, _ := os.UserHomeDir()
 	relPath := path
@@ -231,7 +518,7 @@ func (m *Model) buildFileInfo(path string) FileInfo {
 	// Skip known prefixes
 	for i, part := range parts {
 		skip := false
-		for _, prefix := range m.config.SkipPrefixes {
+		for _, prefix := range skipPrefixes {
 			if part == prefix {
 				skip = true
 				break
@@ -244,24 +531,76 @@ func (m *Model) buildFileInfo(path string) FileInfo {
 	}
 
 	if projectIdx < len(parts) {
-		info.Project = parts[projectIdx]
 		if projectIdx+1 < len(parts) {
-			info.RelPath = strings.Join(parts[projectIdx+1:], "/")
-		} else {
-			info.RelPath = ""
+			return parts[projectIdx], strings.Join(parts[projectIdx+1:], "/")
 		}
-	} else {
-		info.Project = ""
-		info.RelPath = relPath
+		return parts[projectIdx], ""
 	}
+	return "", relPath
+}
 
-	return info
+// countLines returns the number of lines in a text file, or 0 if it looks binary
+// (contains a NUL byte) or can't be read
+func countLines(path string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	buf := make([]byte, 32*1024)
+	lines := 0
+	var last byte
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			if bytes.IndexByte(buf[:n], 0) >= 0 {
+				return 0
+			}
+			lines += bytes.Count(buf[:n], []byte{'\n'})
+			last = buf[n-1]
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	// Count a final line without a trailing newline
+	if last != 0 && last != '\n' {
+		lines++
+	}
+	return lines
+}
+
+func (m *Model) changedCount() int {
+	count := 0
+	for _, f := range m.allFiles {
+		if f.Changed {
+			count++
+		}
+	}
+	return count
+}
+
+// totalLines counts the lines of the files a yank includes (disabled ones are left
+// out). Files over streamThreshold or the exclude size limit count as 0.
+func (m *Model) totalLines() int {
+	total := 0
+	for _, f := range m.allFiles {
+		if !f.Disabled {
+			total += f.Lines
+		}
+	}
+	return total
 }
 
+// totalSize sums the sizes of the files a yank includes (disabled ones are left out)
 func (m *Model) totalSize() int64 {
 	var total int64
-	for _, f := range m.files {
-		total += f.Size
+	for _, f := range m.allFiles {
+		if !f.Disabled {
+			total += f.Size
+		}
 	}
 	return total
 }
@@ -276,8 +615,88 @@ func (m *Model) selectedCount() int {
 	return count
 }
 
+// statusMsg sets the message shown in the status line
+type statusMsg string
+
+// yankProgressMsg reports how many files a background yank has read so far
+type yankProgressMsg struct {
+	done, total int
+	updates     <-chan tea.Msg
+}
+
+// yankDoneMsg is sent when a background yank has finished
+type yankDoneMsg struct {
+	context string               // name of the yanked context
+	source  string               // file the context was opened from (--context-file), if any
+	mtimes  map[string]time.Time // file mtimes at yank time
+	files   int
+	skipped int           // oversized symlinks left out
+	elapsed time.Duration // building the prompt and copying it
+	err     error
+}
+
+// errorMsg is a status message for a failed operation, with the error that caused it
+type errorMsg struct {
+	status string
+	err    error
+}
+
+// errorReport is the last failed operation, kept for copying into a bug report
+type errorReport struct {
+	status  string
+	err     error
+	context string
+	time    time.Time
+}
+
+// setStatus returns a command that shows msg in the status line until the next key press
 func (m *Model) setStatus(msg string) tea.Cmd {
-	return nil
+	return func() tea.Msg {
+		return statusMsg(msg)
+	}
+}
+
+// setError shows "what: err" in the status line and keeps err for ctrl+e
+func (m *Model) setError(what string, err error) tea.Cmd {
+	return func() tea.Msg {
+		return errorMsg{status: fmt.Sprintf("%s: %v", what, err), err: err}
+	}
+}
+
+// setClipboardError reports a failed copy like setError
+func (m *Model) setClipboardError(err error) tea.Cmd {
+	return func() tea.Msg {
+		return errorMsg{status: clipboardErrorStatus(err), err: err}
+	}
+}
+
+// recordError shows status and keeps err as the last error
+func (m *Model) recordError(status string, err error) {
+	m.status = status
+	m.lastError = &errorReport{status: status, err: err, context: m.context.Name, time: time.Now()}
+}
+
+// copyLastError copies the full text of the last error. It goes through the
+// clipboard tools before atotto/clipboard, since atotto may be what failed.
+func (m *Model) copyLastError() tea.Cmd {
+	e := m.lastError
+	if e == nil {
+		return m.setStatus("No error to copy")
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "time: %s\n", e.time.Format(time.RFC3339))
+	fmt.Fprintf(&sb, "context: %s\n", e.context)
+	fmt.Fprintf(&sb, "status: %s\n", e.status)
+	fmt.Fprintf(&sb, "error: %v\n", e.err)
+	for err := errors.Unwrap(e.err); err != nil; err = errors.Unwrap(err) {
+		fmt.Fprintf(&sb, "  wrapped (%T): %v\n", err, err)
+	}
+
+	if err := CopyToClipboardToolsFirst(sb.String()); err != nil {
+		return m.setStatus(fmt.Sprintf("Can't copy the error either: %v", err))
+	}
+	return m.setStatus("Copied last error details")
 }
 
 func (m Model) Init() tea.Cmd {
@@ -293,7 +712,48 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.height = msg.Height
 		return m, nil
 
+	case statusMsg:
+		m.status = string(msg)
+		return m, nil
+
+	case errorMsg:
+		m.recordError(msg.status, msg.err)
+		return m, nil
+
+	case yankProgressMsg:
+		m.yankDone = msg.done
+		m.yankTotal = msg.total
+		return m, waitForYank(msg.updates)
+
+	case yankDoneMsg:
+		m.yanking = false
+		if msg.err != nil {
+			m.quitAfterYank = false
+			m.recordError(clipboardErrorStatus(msg.err), msg.err)
+			return m, nil
+		}
+		m.recordYankMtimes(msg.context, msg.source, msg.mtimes)
+		if m.quitAfterYank {
+			return m.quit()
+		}
+		m.status = fmt.Sprintf("Yanked %d files to clipboard in %s", msg.files, formatElapsed(msg.elapsed))
+		if msg.skipped > 0 {
+			m.status += fmt.Sprintf(" (skipped %d symlink(s) to oversized targets)", msg.skipped)
+		}
+		return m, nil
+
+	case spinner.TickMsg:
+		if !m.yanking {
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+
 	case tea.KeyMsg:
+		// Any key press clears the previous status message
+		m.status = ""
+
 		// Check if this is a paste event
 		if msg.Paste {
 			pastedText := string(msg.Runes)
@@ -320,6 +780,30 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m.handleSelectKey(msg, "context")
 	case modeExcludeSelect:
 		return m.handleSelectKey(msg, "exclude")
+	case modeBackupSelect:
+		return m.handleSelectKey(msg, "backup")
+	case modeTemplateSelect:
+		return m.handleSelectKey(msg, "template")
+	case modeExcludeTest:
+		return m.handleExcludeTestKey(msg)
+	case modeEditPath:
+		return m.handleEditPathKey(msg)
+	case modeContextFromFile:
+		return m.handleContextFromFileKey(msg)
+	case modeProjectRoot:
+		return m.handleProjectRootKey(msg)
+	case modeContextSizes:
+		return m.handleContextSizesKey(msg)
+	case modeAddDirList:
+		return m.handleAddDirListKey(msg)
+	case modeExportHistory:
+		return m.handleExportHistoryKey(msg)
+	case modeEditNote:
+		return m.handleEditNoteKey(msg)
+	case modeExcludeTestResult:
+		// Any key closes the result
+		m.mode = modeNormal
+		return m, nil
 	case modeNewContext:
 		return m.handleNewContextKey(msg)
 	case modeAddFile:
@@ -328,143 +812,591 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m.handleShowConfigKey(msg)
 	case modeEditBox:
 		return m.handleEditBoxKey(msg)
-	case modeConfirmDeleteCtx:
-		return m.handleConfirmDeleteKey(msg)
+	case modeConfirm:
+		return m.handleConfirmKey(msg)
+	case modeHistoryDiff:
+		return m.handleHistoryDiffKey(msg)
+	case modeFullPreview:
+		return m.handleFullPreviewKey(msg)
+	case modeAudit:
+		return m.handleAuditKey(msg)
+	case modeSkipPrefixes:
+		return m.handleSkipPrefixesKey(msg)
+	case modeCommand:
+		return m.handleCommandKey(msg)
+	case modeHelp:
+		return m.handleHelpKey(msg)
+	case modeStats:
+		// Any key closes the stats screen
+		m.mode = modeNormal
+		return m, nil
 	}
 	return m, nil
 }
 
-func (m Model) handleConfirmDeleteKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+func (m Model) handleHistoryDiffKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	key := msg.String()
+	visibleRows := m.visibleFileRows()
 
 	switch key {
-	case "y", "Y":
-		// Confirm deletion
-		if err := DeleteContext(m.deleteTarget); err != nil {
-			m.mode = modeNormal
-			return m, m.setStatus(fmt.Sprintf("Error deleting: %v", err))
-		}
+	case "ctrl+c":
+		return m.quit()
 
-		// If we deleted the active context, switch to another one
-		if m.deleteTarget == m.context.Name {
-			contexts, _ := ListContexts()
-			if len(contexts) > 0 {
-				m.switchToContext(contexts[0])
-			}
-		}
+	case "q", "esc", "=":
+		m.mode = modeNormal
+		m.diffLines = nil
+		return m, nil
 
-		// Refresh contexts list
-		contexts, _ := ListContexts()
-		m.contexts = contexts
+	case "?":
+		return m.openHelp()
 
-		m.mode = modeNormal
-		m.deleteTarget = ""
-		return m, m.setStatus("Context deleted")
+	case "up", "k":
+		if m.diffOffset > 0 {
+			m.diffOffset--
+		}
 
-	case "n", "N", "esc", "q":
-		// Cancel
-		m.mode = modeContextSelect
-		m.deleteTarget = ""
-		return m, nil
+	case "down", "j":
+		if m.diffOffset < len(m.diffLines)-visibleRows {
+			m.diffOffset++
+		}
 	}
 
 	return m, nil
 }
 
-func (m Model) handleEditBoxKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch msg.Type {
-	case tea.KeyEnter:
-		// Save and exit edit mode
-		if m.editingBox == boxRequest {
-			m.context.Request = m.textArea.Value()
-		} else if m.editingBox == boxProjectContext {
-			m.context.ProjectContext = m.textArea.Value()
-		}
-		SaveContext(m.context)
-		m.mode = modeNormal
-		m.editingBox = -1
-		return m, nil
+func (m Model) handleFullPreviewKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	key := msg.String()
+	visibleRows := m.visibleFileRows()
+	maxOffset := max(len(m.pagerLines)-visibleRows, 0)
 
-	case tea.KeyEsc, tea.KeyCtrlC:
-		// Cancel without saving
+	switch key {
+	case "ctrl+c":
+		return m.quit()
+
+	case "q", "esc", "v":
 		m.mode = modeNormal
-		m.editingBox = -1
+		m.pagerLines = nil
+		m.pagerLangs = nil
 		return m, nil
+
+	case "?":
+		return m.openHelp()
+
+	case "up", "k":
+		if m.pagerOffset > 0 {
+			m.pagerOffset--
+		}
+
+	case "down", "j":
+		if m.pagerOffset < maxOffset {
+			m.pagerOffset++
+		}
+
+	case "pgup", "b":
+		m.pagerOffset = max(m.pagerOffset-visibleRows, 0)
+
+	case "pgdown", " ":
+		m.pagerOffset = min(m.pagerOffset+visibleRows, maxOffset)
+
+	case "g":
+		m.pagerOffset = 0
+
+	case "G":
+		m.pagerOffset = maxOffset
 	}
 
-	// Pass other keys to textarea
-	var cmd tea.Cmd
-	m.textArea, cmd = m.textArea.Update(msg)
-	return m, cmd
+	return m, nil
 }
 
-func (m Model) handleNormalKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+func (m Model) handleAuditKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	key := msg.String()
 	visibleRows := m.visibleFileRows()
 
 	switch key {
-	case "q", "ctrl+c":
-		return m, tea.Quit
+	case "ctrl+c":
+		return m.quit()
+
+	case "q", "esc":
+		m.mode = modeNormal
+		m.auditLines = nil
+		return m, nil
+
+	case "?":
+		return m.openHelp()
 
 	case "up", "k":
-		if m.activeTab == tabHistory {
-			// Navigate history
-			if m.historyCursor > 0 {
-				m.historyCursor--
-				if m.historyCursor < m.historyOffset {
-					m.historyOffset = m.historyCursor
-				}
-			}
-		} else {
-			// Navigate files
-			if m.cursor > 0 {
-				m.cursor--
-				if m.cursor < m.offset {
-					m.offset = m.cursor
-				}
-			}
+		if m.auditOffset > 0 {
+			m.auditOffset--
 		}
 
 	case "down", "j":
-		if m.activeTab == tabHistory {
-			// Navigate history
-			if m.historyCursor < len(m.historyEntries)-1 {
-				m.historyCursor++
-				if m.historyCursor >= m.historyOffset+visibleRows {
-					m.historyOffset = m.historyCursor - visibleRows + 1
-				}
-			}
-		} else {
-			// Navigate files
-			if m.cursor < len(m.files)-1 {
-				m.cursor++
-				if m.cursor >= m.offset+visibleRows {
-					m.offset = m.cursor - visibleRows + 1
-				}
-			}
+		if m.auditOffset < len(m.auditLines)-visibleRows {
+			m.auditOffset++
 		}
+	}
 
-	case " ":
-		// Toggle selection
-		if m.cursor < len(m.files) {
-			m.files[m.cursor].Selected = !m.files[m.cursor].Selected
-		}
+	return m, nil
+}
 
-	case "*":
-		// Select/deselect all
-		allSelected := true
-		for _, f := range m.files {
-			if !f.Selected {
-				allSelected = false
-				break
-			}
+// openAudit scans all contexts and shows the shared/missing files report
+func (m Model) openAudit() (tea.Model, tea.Cmd) {
+	shared, missing := auditContexts()
+
+	// section renders one group of paths, sorted, with their contexts
+	section := func(title string, files map[string][]string) []string {
+		lines := []string{fmt.Sprintf("%s (%d)", title, len(files))}
+		if len(files) == 0 {
+			return append(lines, "  (none)", "")
 		}
-		for i := range m.files {
-			m.files[i].Selected = !allSelected
+		paths := make([]string, 0, len(files))
+		for p := range files {
+			paths = append(paths, p)
 		}
+		sort.Strings(paths)
+		for _, p := range paths {
+			names := files[p]
+			sort.Strings(names)
+			lines = append(lines, "  "+m.showPath(p), "    "+strings.Join(names, ", "))
+		}
+		return append(lines, "")
+	}
 
-	case "D":
-		// Clear all files
+	m.auditLines = append(section("Shared by several contexts", shared), section("Missing", missing)...)
+
+	// Contexts that can't be loaded aren't part of the scan above
+	broken := UnloadableContexts()
+	m.auditLines = append(m.auditLines, fmt.Sprintf("Unloadable contexts (%d)", len(broken)))
+	if len(broken) == 0 {
+		m.auditLines = append(m.auditLines, "  (none)")
+	}
+	for _, name := range slices.Sorted(maps.Keys(broken)) {
+		m.auditLines = append(m.auditLines, "  "+name)
+		for _, line := range strings.Split(broken[name].Error(), "\n") {
+			m.auditLines = append(m.auditLines, "    "+strings.TrimSpace(line))
+		}
+	}
+	m.auditTitle = "Context Audit"
+	m.auditOffset = 0
+	m.mode = modeAudit
+	return m, nil
+}
+
+// currentPrompt builds the prompt for the active context exactly as yank would
+func (m Model) currentPrompt() string {
+	paths, _ := m.yankablePaths()
+	return buildPrompt(m.config, promptInput{
+		ProjectContext: m.context.ProjectContext,
+		Request:        m.context.Request,
+		ProjectRoot:    m.projectRoot(),
+		Files:          paths,
+		Notes:          m.context.Notes,
+		GitDiff:        promptGitDiff(m.config, m.gitDir()),
+		Cache:          m.cache,
+	})
+}
+
+// exportMarkdown writes the current prompt as <context>.prompt.md into the project
+// root (or the working directory without one)
+func (m *Model) exportMarkdown() tea.Cmd {
+	path := filepath.Join(m.gitDir(), sanitizeFilename(m.context.Name)+".prompt.md")
+	doc := markdownPrompt(m.config, m.context.Name, m.currentPrompt(), time.Now())
+	if err := os.WriteFile(path, []byte(doc), 0644); err != nil {
+		return m.setError("Error writing", err)
+	}
+	return m.setStatus(fmt.Sprintf("Wrote %s (%s)", m.showPath(path), formatSize(int64(len(doc)))))
+}
+
+// openFullPreview builds the prompt exactly as yank would and shows it in a pager
+func (m Model) openFullPreview() (tea.Model, tea.Cmd) {
+	prompt := m.currentPrompt()
+
+	m.pagerLines = strings.Split(strings.TrimRight(prompt, "\n"), "\n")
+	m.pagerLangs = make([]string, len(m.pagerLines))
+	lang := ""
+	for i, line := range m.pagerLines {
+		switch {
+		case strings.HasPrefix(line, "<file path=\""):
+			path, _, _ := strings.Cut(strings.TrimPrefix(line, "<file path=\""), "\"")
+			lang = languageForPath(path)
+			continue
+		case line == "</file>":
+			lang = ""
+			continue
+		}
+		m.pagerLangs[i] = lang
+	}
+	m.pagerOffset = 0
+	m.mode = modeFullPreview
+	return m, nil
+}
+
+// confirmPrompt is a pending yes/no confirmation
+type confirmPrompt struct {
+	title      string
+	lines      []string // message body
+	warning    string   // optional warning shown below the message
+	onConfirm  func(m *Model) tea.Cmd
+	onDeny     func(m *Model) tea.Cmd // when set, "n" runs this and esc cancels
+	cancelMode mode                   // mode to return to when cancelled
+}
+
+// askConfirm switches to the confirmation prompt
+func (m *Model) askConfirm(p confirmPrompt) {
+	m.confirm = p
+	m.mode = modeConfirm
+}
+
+func (m Model) handleConfirmKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	key := msg.String()
+
+	switch key {
+	case "y", "Y":
+		p := m.confirm
+		m.confirm = confirmPrompt{}
+		m.mode = modeNormal
+		return m, p.onConfirm(&m)
+
+	case "n", "N", "esc", "q":
+		if m.confirm.onDeny != nil && (key == "n" || key == "N") {
+			p := m.confirm
+			m.confirm = confirmPrompt{}
+			m.mode = modeNormal
+			return m, p.onDeny(&m)
+		}
+
+		// Cancel
+		m.quitAfterYank = false
+		m.mode = m.confirm.cancelMode
+		m.confirm = confirmPrompt{}
+		return m, nil
+	}
+
+	return m, nil
+}
+
+// deleteBackupWarning tells the user how to undo a context delete
+const deleteBackupWarning = "A backup is kept; run 'restore context backup' from the command palette (:) to undo."
+
+// confirmDeleteContext asks before deleting a context
+func (m *Model) confirmDeleteContext(name string, cancelMode mode) {
+	m.askConfirm(confirmPrompt{
+		title:      "Delete Context",
+		lines:      []string{fmt.Sprintf("Are you sure you want to delete '%s'?", name)},
+		warning:    deleteBackupWarning,
+		cancelMode: cancelMode,
+		onConfirm: func(m *Model) tea.Cmd {
+			if err := DeleteContext(name); err != nil {
+				return m.setError("Error deleting", err)
+			}
+			m.dropFavorite(name)
+
+			// If we deleted the active context, switch to another one
+			if name == m.context.Name {
+				if ctx, err := LoadFallbackContext(); err == nil {
+					m.setActiveContext(ctx)
+				}
+			}
+
+			// Refresh contexts list
+			contexts, _ := ListContexts()
+			m.contexts = contexts
+
+			return m.setStatus("Context deleted")
+		},
+	})
+}
+
+// confirmResetExclude asks before replacing the patterns of an exclude rule with
+// DefaultExcludePatterns; its size limits and include list are kept
+func (m *Model) confirmResetExclude(name string, returnMode mode) {
+	exc, err := LoadExcludeRule(name)
+	if err != nil {
+		m.mode = returnMode
+		m.recordError(fmt.Sprintf("Error: %v", err), err)
+		return
+	}
+
+	defaults := DefaultExcludePatterns()
+	var removed, added []string
+	for _, p := range exc.Patterns {
+		if !slices.Contains(defaults, p) {
+			removed = append(removed, p)
+		}
+	}
+	for _, p := range defaults {
+		if !slices.Contains(exc.Patterns, p) {
+			added = append(added, p)
+		}
+	}
+	if len(removed) == 0 && len(added) == 0 && len(exc.Patterns) == len(defaults) {
+		m.mode = returnMode
+		m.status = fmt.Sprintf("Exclude rule '%s' already has the default patterns", name)
+		return
+	}
+
+	lines := []string{fmt.Sprintf("Reset the patterns of exclude rule '%s' to the %d defaults?", name, len(defaults))}
+	for _, group := range []struct {
+		label    string
+		patterns []string
+	}{{"Removes", removed}, {"Adds", added}} {
+		if len(group.patterns) == 0 {
+			continue
+		}
+		lines = append(lines, "", group.label+":")
+		for _, p := range group.patterns {
+			lines = append(lines, "  "+p)
+		}
+	}
+
+	m.askConfirm(confirmPrompt{
+		title:      "Reset Exclude Rule",
+		lines:      lines,
+		warning:    "Size limits and include are kept. The rule may be shared with other contexts.",
+		cancelMode: returnMode,
+		onConfirm: func(m *Model) tea.Cmd {
+			m.mode = returnMode
+			exc.Patterns = defaults
+			if err := SaveExcludeRule(exc); err != nil {
+				return m.setError("Error saving", err)
+			}
+			m.refreshExclude()
+			return m.setStatus(fmt.Sprintf("Reset exclude rule '%s' to the default patterns", name))
+		},
+	})
+}
+
+// resetActiveExclude offers to reset the effective exclude rule to the default patterns
+func (m *Model) resetActiveExclude() {
+	m.confirmResetExclude(m.effectiveExcludeName(), modeNormal)
+}
+
+// confirmDeleteContexts asks before deleting several contexts at once
+func (m *Model) confirmDeleteContexts(names []string) {
+	lines := []string{fmt.Sprintf("Are you sure you want to delete %d contexts?", len(names)), ""}
+	for _, name := range names {
+		lines = append(lines, "  "+name)
+	}
+
+	m.askConfirm(confirmPrompt{
+		title:      "Delete Contexts",
+		lines:      lines,
+		warning:    deleteBackupWarning,
+		cancelMode: modeContextSelect,
+		onConfirm: func(m *Model) tea.Cmd {
+			deleted := 0
+			deletedActive := false
+			for _, name := range names {
+				if err := DeleteContext(name); err != nil {
+					continue
+				}
+				m.dropFavorite(name)
+				deleted++
+				if name == m.context.Name {
+					deletedActive = true
+				}
+			}
+
+			// If we deleted the active context, switch to another one
+			if deletedActive {
+				if ctx, err := LoadFallbackContext(); err == nil {
+					m.setActiveContext(ctx)
+				}
+			}
+			m.contexts, _ = ListContexts()
+
+			return m.setStatus(fmt.Sprintf("Deleted %d contexts", deleted))
+		},
+	})
+}
+
+func (m Model) handleEditBoxKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEnter:
+		// Save and exit edit mode
+		m.saveEditBox()
+		return m, nil
+
+	case tea.KeyCtrlC:
+		// Don't throw away a changed text silently
+		if m.dirty {
+			m.confirmUnsavedEdit()
+			return m, nil
+		}
+		m.closeEditBox()
+		return m, nil
+
+	case tea.KeyEsc:
+		// Cancel without saving
+		m.closeEditBox()
+		return m, nil
+	}
+
+	// Pass other keys to textarea
+	var cmd tea.Cmd
+	m.textArea, cmd = m.textArea.Update(msg)
+	m.dirty = m.textArea.Value() != m.storedBoxValue()
+	return m, cmd
+}
+
+// storedBoxValue returns the saved text of the box being edited
+func (m Model) storedBoxValue() string {
+	if m.editingBox == boxProjectContext {
+		return m.context.ProjectContext
+	}
+	return m.context.Request
+}
+
+// saveEditBox stores the textarea content in the edited box and leaves edit mode
+func (m *Model) saveEditBox() {
+	if m.editingBox == boxRequest {
+		m.context.Request = m.textArea.Value()
+	} else if m.editingBox == boxProjectContext {
+		m.context.ProjectContext = m.textArea.Value()
+	}
+	SaveContext(m.context)
+	m.closeEditBox()
+}
+
+// closeEditBox leaves edit mode without saving
+func (m *Model) closeEditBox() {
+	m.mode = modeNormal
+	m.editingBox = -1
+	m.dirty = false
+}
+
+// confirmUnsavedEdit asks whether to save, discard or keep editing a changed box
+func (m *Model) confirmUnsavedEdit() {
+	name := "Request"
+	if m.editingBox == boxProjectContext {
+		name = "Project Context"
+	}
+	m.askConfirm(confirmPrompt{
+		title:      "Unsaved Edits",
+		lines:      []string{fmt.Sprintf("Save your changes to %s?", name)},
+		warning:    "[n] discards them; [esc] keeps editing.",
+		cancelMode: modeEditBox,
+		onConfirm: func(m *Model) tea.Cmd {
+			m.saveEditBox()
+			return m.setStatus("Saved " + name)
+		},
+		onDeny: func(m *Model) tea.Cmd {
+			m.closeEditBox()
+			return m.setStatus("Discarded changes to " + name)
+		},
+	})
+}
+
+func (m Model) handleNormalKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	key := msg.String()
+	visibleRows := m.visibleFileRows()
+
+	// Digits build a row number to jump to in the Files box
+	if m.activeTab == tabContext && m.activeBox == boxFiles && len(key) == 1 && key >= "0" && key <= "9" {
+		if key != "0" || m.countBuffer != "" {
+			m.countBuffer += key
+			return m, m.setStatus("Go to file: " + m.countBuffer)
+		}
+	}
+	if m.countBuffer != "" {
+		count := m.countBuffer
+		m.countBuffer = ""
+		switch key {
+		case "enter":
+			n, _ := strconv.Atoi(count)
+			m.jumpToFile(n - 1)
+			return m, nil
+		case "esc":
+			return m, nil
+		case "backspace":
+			m.countBuffer = count[:len(count)-1]
+			if m.countBuffer != "" {
+				return m, m.setStatus("Go to file: " + m.countBuffer)
+			}
+			return m, nil
+		}
+		// Any other key cancels the jump and is handled normally
+	}
+
+	switch key {
+	case "q", "ctrl+c":
+		return m.quit()
+
+	case "up", "k", "down", "j":
+		delta := 1
+		if key == "up" || key == "k" {
+			delta = -1
+		}
+		if m.activeTab == tabHistory {
+			// Navigate history
+			m.historyCursor, m.historyOffset = stepCursor(m.historyCursor, m.historyOffset,
+				len(m.historyEntries), delta, visibleRows, m.config.WrapNavigation)
+		} else {
+			// Navigate files
+			m.cursor, m.offset = stepCursor(m.cursor, m.offset, len(m.files), delta, visibleRows, m.config.WrapNavigation)
+		}
+
+	case " ":
+		if m.activeTab == tabHistory {
+			// Mark/unmark diff base
+			if m.historyBase == m.historyCursor {
+				m.historyBase = -1
+			} else if m.historyCursor < len(m.historyEntries) {
+				m.historyBase = m.historyCursor
+			}
+			return m, nil
+		}
+		// Toggle selection
+		if m.cursor < len(m.files) {
+			m.files[m.cursor].Selected = !m.files[m.cursor].Selected
+		}
+
+	case "=":
+		// Diff marked base against cursor entry
+		if m.activeTab == tabHistory {
+			return m.enterHistoryDiff()
+		}
+
+	case "*":
+		// Select/deselect all
+		allSelected := true
+		for _, f := range m.files {
+			if !f.Selected {
+				allSelected = false
+				break
+			}
+		}
+		for i := range m.files {
+			m.files[i].Selected = !allSelected
+		}
+
+	case "!":
+		// Show only missing files, or all again
+		if m.activeTab == tabContext {
+			return m, m.toggleMissingOnly()
+		}
+
+	case "m":
+		// Select all missing files
+		for i := range m.files {
+			if !m.files[i].Exists {
+				m.files[i].Selected = true
+			}
+		}
+
+	case "u":
+		// Clear all selections
+		for i := range m.files {
+			m.files[i].Selected = false
+		}
+
+	case "w":
+		// Toggle word-wrap in boxes and preview
+		m.config.WrapText = !m.config.WrapText
+		SaveConfig(m.config)
+
+	case "D":
+		// Clear all files
+		backupContext(m.context)
 		m.context.Files = []string{}
 		SaveContext(m.context)
 		m.refreshFiles()
@@ -477,22 +1409,154 @@ func (m Model) handleNormalKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		}
 		return m, m.yank()
 
+	case "Y":
+		// Yank and quit once the copy succeeds
+		if m.activeTab == tabContext {
+			m.quitAfterYank = true
+			return m, m.yank()
+		}
+
 	case "d":
 		return m, m.deleteSelected()
 
+	case "M":
+		// Remove all missing files
+		return m, m.removeMissing()
+
+	case "o":
+		// Cycle file sort mode, or flip the history order
+		if m.activeTab == tabContext {
+			return m, m.cycleSortMode()
+		}
+		return m, m.toggleHistoryOrder()
+
+	case "J":
+		// Move cursor file down (custom sort)
+		if m.activeTab == tabContext {
+			return m, m.moveCursorFile(1)
+		}
+
+	case "K":
+		// Move cursor file up (custom sort)
+		if m.activeTab == tabContext {
+			return m, m.moveCursorFile(-1)
+		}
+
+	case "F":
+		// Copy cursor file wrapped in its <file> tag
+		if m.activeTab == tabContext {
+			return m, m.yankCursorFile()
+		}
+
+	case "v":
+		// Scroll through the full prompt
+		if m.activeTab == tabContext {
+			return m.openFullPreview()
+		}
+
+	case "V":
+		// Copy the preview box text
+		if m.activeTab == tabContext {
+			return m, m.copyPreview()
+		}
+
+	case "n":
+		// Edit the cursor file's note
+		if m.activeTab == tabContext && m.cursor < len(m.files) {
+			m.editPathOrig = m.files[m.cursor].Path
+			m.inputBuffer = m.context.Notes[m.editPathOrig]
+			m.mode = modeEditNote
+			return m, nil
+		}
+
+	case "p":
+		// Copy path of cursor file
+		if m.activeTab == tabContext {
+			return m, m.copyCursorPath()
+		}
+
+	case "ctrl+y":
+		// Copy only the preamble, project context and request
+		if m.activeTab == tabContext {
+			return m, m.copyInstructions()
+		}
+
+	case "ctrl+e":
+		// Copy the full text of the last error
+		return m, m.copyLastError()
+
+	case "$":
+		// Copy a ctx command line that rebuilds the file list
+		if m.activeTab == tabContext {
+			return m, m.copyShellCommand()
+		}
+
+	case "S":
+		// Swap Request and Project Context (fixes a paste into the wrong box)
+		if m.activeTab == tabContext {
+			return m, m.swapBoxes()
+		}
+
+	case "x":
+		// Disable/enable the cursor file for yanking
+		if m.activeTab == tabContext {
+			return m, m.toggleFileDisabled()
+		}
+
+	case "P":
+		// Toggle pin on history entry, or on the cursor file
+		if m.activeTab == tabHistory {
+			return m, m.toggleHistoryPin()
+		}
+		return m, m.toggleFilePin()
+
 	case "c":
 		return m.enterContextSelect()
 
+	case "N":
+		return m, m.initContextHere()
+
 	case "E":
 		return m.enterExcludeSelect()
 
+	case "X":
+		// Exclude the cursor file's extension
+		if m.activeTab == tabContext {
+			return m, m.excludeCursorExtension()
+		}
+
+	case "R":
+		// Set the project root (prefilled with the current or detected one)
+		m.mode = modeProjectRoot
+		m.inputBuffer = m.context.ProjectRoot
+		if m.inputBuffer == "" {
+			m.inputBuffer = DetectProjectRoot(m.context)
+		}
+		return m, nil
+
+	case "T":
+		// Test the exclude rule on a directory (defaults to the project root)
+		m.mode = modeExcludeTest
+		m.inputBuffer = m.projectRoot()
+		return m, nil
+
 	case "r":
 		return m.reload()
 
+	case "ctrl+r":
+		// Reload only the cursor file
+		if m.activeTab == tabContext {
+			return m, m.reloadCursorFile()
+		}
+
 	case "s":
 		m.mode = modeShowConfig
 		return m, nil
 
+	case "i":
+		m.mode = modeStats
+		return m, nil
+
 	case "a":
 		m.mode = modeAddFile
 		m.inputBuffer = ""
@@ -518,45 +1582,41 @@ func (m Model) handleNormalKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.activeBox = boxRequest
 		}
 
+	case "1", "2", "3", "4", "5", "6", "7", "8", "9":
+		// Jump to a favorite context (in the Files box digits jump to a row instead)
+		n, _ := strconv.Atoi(key)
+		return m, m.jumpToFavorite(n)
+
 	case "{":
 		// Previous context
-		if len(m.contexts) > 1 {
-			currentIdx := -1
-			for i, name := range m.contexts {
-				if name == m.context.Name {
-					currentIdx = i
-					break
-				}
-			}
-			if currentIdx > 0 {
-				m.switchToContext(m.contexts[currentIdx-1])
-			} else {
-				m.switchToContext(m.contexts[len(m.contexts)-1])
-			}
-		}
+		return m, m.cycleContext(-1)
 
 	case "}":
 		// Next context
-		if len(m.contexts) > 1 {
-			currentIdx := -1
-			for i, name := range m.contexts {
-				if name == m.context.Name {
-					currentIdx = i
-					break
-				}
-			}
-			if currentIdx < len(m.contexts)-1 {
-				m.switchToContext(m.contexts[currentIdx+1])
-			} else {
-				m.switchToContext(m.contexts[0])
-			}
-		}
+		return m, m.cycleContext(1)
+
+	case "ctrl+o":
+		// Back to the previously active context
+		return m, m.contextBack()
+
+	case ":":
+		return m.enterCommandPalette()
+
+	case "?":
+		return m.openHelp()
 
 	case "enter", "e":
 		// Enter edit mode for Request or Project Context (only in context tab)
 		if m.activeTab == tabContext && (m.activeBox == boxRequest || m.activeBox == boxProjectContext) {
 			return m.enterEditMode()
 		}
+		// Edit the cursor file's path when the Files box is active
+		if m.activeTab == tabContext && m.activeBox == boxFiles && m.cursor < len(m.files) {
+			m.editPathOrig = m.files[m.cursor].Path
+			m.inputBuffer = m.editPathOrig
+			m.mode = modeEditPath
+			return m, nil
+		}
 
 	case "<":
 		// Switch to previous tab
@@ -569,17 +1629,33 @@ func (m Model) handleNormalKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		if m.activeTab == tabContext {
 			m.activeTab = tabHistory
 			// Load history entries when switching to history tab
-			entries, _ := ListHistoryEntries()
-			m.historyEntries = entries
+			m.loadHistoryEntries()
 			m.historyCursor = 0
 			m.historyOffset = 0
+			m.historyBase = -1
 		}
 	}
 
 	return m, nil
 }
 
-func (m Model) enterEditMode() (tea.Model, tea.Cmd) {
+func (m Model) enterHistoryDiff() (tea.Model, tea.Cmd) {
+	if m.historyBase < 0 || m.historyBase >= len(m.historyEntries) {
+		return m, m.setStatus("Mark a base entry with space first")
+	}
+	if m.historyCursor >= len(m.historyEntries) {
+		return m, m.setStatus("No history entry selected")
+	}
+
+	base := m.historyEntries[m.historyBase]
+	other := m.historyEntries[m.historyCursor]
+	m.diffLines = strings.Split(strings.TrimSuffix(diffHistory(base, other), "\n"), "\n")
+	m.diffOffset = 0
+	m.mode = modeHistoryDiff
+	return m, nil
+}
+
+func (m Model) enterEditMode() (tea.Model, tea.Cmd) {
 	// Create textarea with current content
 	ta := textarea.New()
 	ta.Placeholder = "Type here..."
@@ -596,6 +1672,7 @@ func (m Model) enterEditMode() (tea.Model, tea.Cmd) {
 	ta.Focus()
 	m.textArea = ta
 	m.editingBox = m.activeBox
+	m.dirty = false
 	m.mode = modeEditBox
 
 	return m, textarea.Blink
@@ -612,47 +1689,253 @@ func (m Model) visibleFileRows() int {
 	return available
 }
 
-func (m *Model) switchToContext(name string) {
+// jumpToFile moves the cursor to file index idx (clamped to range)
+func (m *Model) jumpToFile(idx int) {
+	if len(m.files) == 0 {
+		return
+	}
+	m.cursor = max(0, min(idx, len(m.files)-1))
+
+	visibleRows := m.visibleFileRows()
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	} else if m.cursor >= m.offset+visibleRows {
+		m.offset = m.cursor - visibleRows + 1
+	}
+}
+
+// stepCursor moves cursor by delta in a list of n rows and scrolls offset so the
+// cursor stays visible. Past either end it stops, or jumps to the other end if wrap is set.
+func stepCursor(cursor, offset, n, delta, visibleRows int, wrap bool) (int, int) {
+	if n == 0 {
+		return cursor, offset
+	}
+	next := cursor + delta
+	if next < 0 || next >= n {
+		if !wrap {
+			return cursor, offset
+		}
+		next = (next%n + n) % n
+	}
+
+	if next < offset {
+		offset = next
+	} else if next >= offset+visibleRows {
+		offset = next - visibleRows + 1
+	}
+	return next, offset
+}
+
+// initContextHere creates a context from the working directory and switches to it
+func (m *Model) initContextHere() tea.Cmd {
+	dir, err := os.Getwd()
+	if err != nil {
+		return m.setError("Error", err)
+	}
+
+	ctx, added, err := NewContextFromDir(dir, m.config)
+	if err != nil {
+		return m.setError("Error", err)
+	}
+
+	m.contexts, _ = ListContexts()
+	if cmd := m.switchToContext(ctx.Name); cmd != nil {
+		return cmd
+	}
+	return m.setStatus(fmt.Sprintf("Created context %s with %d files", ctx.Name, added))
+}
+
+// maxContextHistory caps the context back-stack
+const maxContextHistory = 10
+
+// switchToContext makes name the active context, remembering the current one for
+// ctrl+o. A context that can't be loaded is reported in the status line and the
+// active context is kept (nothing is pushed).
+func (m *Model) switchToContext(name string) tea.Cmd {
 	ctx, err := LoadContext(name)
 	if err != nil {
+		return m.setError(fmt.Sprintf("Can't load context %s", name), err)
+	}
+	if name != m.context.Name {
+		m.pushContextHistory(m.context.Name)
+	}
+	m.setActiveContext(ctx)
+	return nil
+}
+
+// maxFavorites is the number of favorite contexts, one per digit key
+const maxFavorites = 9
+
+// jumpToFavorite switches to the nth (1-based) favorite context
+func (m *Model) jumpToFavorite(n int) tea.Cmd {
+	if n > len(m.config.FavoriteContexts) {
+		return m.setStatus(fmt.Sprintf("No favorite %d (ctrl+f in the context picker adds one)", n))
+	}
+	name := m.config.FavoriteContexts[n-1]
+	if name == m.context.Name {
+		return m.setStatus("Already on " + name)
+	}
+	if cmd := m.switchToContext(name); cmd != nil {
+		return cmd
+	}
+	return m.setStatus(fmt.Sprintf("Switched to favorite %d: %s", n, name))
+}
+
+// toggleFavorite adds name to the favorite contexts (as the next digit) or removes it
+func (m *Model) toggleFavorite(name string) tea.Cmd {
+	if i := slices.Index(m.config.FavoriteContexts, name); i >= 0 {
+		m.config.FavoriteContexts = slices.Delete(m.config.FavoriteContexts, i, i+1)
+		if err := SaveConfig(m.config); err != nil {
+			return m.setError("Error saving config", err)
+		}
+		return m.setStatus("Removed " + name + " from favorites")
+	}
+
+	if len(m.config.FavoriteContexts) >= maxFavorites {
+		return m.setStatus(fmt.Sprintf("Already %d favorites; remove one first", maxFavorites))
+	}
+	m.config.FavoriteContexts = append(m.config.FavoriteContexts, name)
+	if err := SaveConfig(m.config); err != nil {
+		return m.setError("Error saving config", err)
+	}
+	return m.setStatus(fmt.Sprintf("Added %s as favorite %d", name, len(m.config.FavoriteContexts)))
+}
+
+// dropFavorite removes a deleted context from the favorites
+func (m *Model) dropFavorite(name string) {
+	if i := slices.Index(m.config.FavoriteContexts, name); i >= 0 {
+		m.config.FavoriteContexts = slices.Delete(m.config.FavoriteContexts, i, i+1)
+		SaveConfig(m.config)
+	}
+}
+
+// cycleContext switches to the next (step 1) or previous (step -1) context in the
+// list, skipping contexts that can't be loaded
+func (m *Model) cycleContext(step int) tea.Cmd {
+	n := len(m.contexts)
+	if n < 2 {
+		return nil
+	}
+	idx := slices.Index(m.contexts, m.context.Name)
+	if idx < 0 && step < 0 {
+		idx = 0 // previous from an unlisted context is the last one
+	}
+
+	var skipped []string
+	for i := 1; i <= n; i++ {
+		name := m.contexts[((idx+i*step)%n+n)%n]
+		if name == m.context.Name {
+			break
+		}
+		ctx, err := LoadContext(name)
+		if err != nil {
+			skipped = append(skipped, name)
+			continue
+		}
+		m.pushContextHistory(m.context.Name)
+		m.setActiveContext(ctx)
+		break
+	}
+	if len(skipped) > 0 {
+		return m.setStatus("Skipped unloadable contexts: " + strings.Join(skipped, ", "))
+	}
+	return nil
+}
+
+// pushContextHistory records name as the previously active context. An existing
+// entry for it is moved to the top rather than duplicated.
+func (m *Model) pushContextHistory(name string) {
+	// A context opened from a file can't be reopened by name
+	if name == m.context.Name && m.context.SourcePath != "" {
 		return
 	}
+	for i, n := range m.contextHistory {
+		if n == name {
+			m.contextHistory = append(m.contextHistory[:i], m.contextHistory[i+1:]...)
+			break
+		}
+	}
+	m.contextHistory = append(m.contextHistory, name)
+	if len(m.contextHistory) > maxContextHistory {
+		m.contextHistory = m.contextHistory[len(m.contextHistory)-maxContextHistory:]
+	}
+}
+
+// contextBack returns to the previously active context, skipping deleted ones
+func (m *Model) contextBack() tea.Cmd {
+	for len(m.contextHistory) > 0 {
+		name := m.contextHistory[len(m.contextHistory)-1]
+		m.contextHistory = m.contextHistory[:len(m.contextHistory)-1]
+		if name == m.context.Name {
+			continue
+		}
+		ctx, err := LoadContext(name)
+		if err != nil {
+			continue
+		}
+		m.setActiveContext(ctx)
+		return m.setStatus("Back to " + name)
+	}
+	return m.setStatus("No previous context")
+}
+
+// setActiveContext makes ctx the active context and saves it to the config
+func (m *Model) setActiveContext(ctx Context) {
 	m.context = ctx
-	m.config.ActiveContext = name
+	m.config.ActiveContext = ctx.Name
 	SaveConfig(m.config)
+	m.refreshExclude()
 	m.refreshFiles()
 	m.cursor = 0
 	m.offset = 0
 }
 
+// projectRoot returns the active context's project root, falling back to the project config's
+func (m *Model) projectRoot() string {
+	return EffectiveProjectRoot(m.config, m.context)
+}
+
+// effectiveExcludeName returns the active context's exclude rule, falling back to the global one
+func (m *Model) effectiveExcludeName() string {
+	if m.context.ExcludeRule != "" {
+		return m.context.ExcludeRule
+	}
+	return m.config.ActiveExclude
+}
+
+// refreshExclude loads the effective exclude rule for the active context
+func (m *Model) refreshExclude() error {
+	exc, err := LoadEffectiveExclude(m.config, m.context)
+	if err != nil {
+		return err
+	}
+	m.exclude = exc
+	return nil
+}
+
 func (m Model) handleFolderKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	key := msg.String()
 	visibleRows := m.visibleFileRows()
 
 	switch key {
 	case "q", "ctrl+c":
-		return m, tea.Quit
+		return m.quit()
 
 	case "f", "esc":
 		// Back to file view
 		m.mode = modeNormal
 		return m, nil
 
+	case "?":
+		return m.openHelp()
+
 	case "up", "k":
-		if m.folderCursor > 0 {
-			m.folderCursor--
-			if m.folderCursor < m.folderOffset {
-				m.folderOffset = m.folderCursor
-			}
-		}
+		m.folderCursor, m.folderOffset = stepCursor(m.folderCursor, m.folderOffset,
+			len(m.folders), -1, visibleRows, m.config.WrapNavigation)
 
 	case "down", "j":
-		if m.folderCursor < len(m.folders)-1 {
-			m.folderCursor++
-			if m.folderCursor >= m.folderOffset+visibleRows {
-				m.folderOffset = m.folderCursor - visibleRows + 1
-			}
-		}
+		m.folderCursor, m.folderOffset = stepCursor(m.folderCursor, m.folderOffset,
+			len(m.folders), 1, visibleRows, m.config.WrapNavigation)
 
 	case " ":
 		// Toggle selection
@@ -660,6 +1943,20 @@ func (m Model) handleFolderKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.folders[m.folderCursor].Selected = !m.folders[m.folderCursor].Selected
 		}
 
+	case "x":
+		// Exclude the cursor folder persistently (<folder>/**) and remove its files
+		if m.folderCursor < len(m.folders) {
+			folder := m.folders[m.folderCursor].Path
+			var matching []string
+			for _, f := range m.context.Files {
+				if strings.HasPrefix(f, folder+"/") {
+					matching = append(matching, f)
+				}
+			}
+			m.confirmExcludePattern("Exclude Folder", folder+"/**", matching, modeFolderView)
+			return m, nil
+		}
+
 	case "d":
 		// Delete files in selected folders (or cursor folder)
 		var foldersToDelete []string
@@ -689,6 +1986,7 @@ func (m Model) handleFolderKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 				newFiles = append(newFiles, file)
 			}
 		}
+		backupContext(m.context)
 		m.context.Files = newFiles
 		SaveContext(m.context)
 		m.refreshFiles()
@@ -707,163 +2005,773 @@ func (m Model) handleFolderKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// newContextItem is the context picker entry for creating a context
+const newContextItem = "[+] New context"
+
+// selectFilterable reports whether the current picker narrows its items as you type
+func (m Model) selectFilterable() bool {
+	return m.mode == modeContextSelect || m.mode == modeExcludeSelect
+}
+
+// visibleSelectItems returns the picker items matching selectFilter. While filtering,
+// the new-context entry stays visible at the end so a typed name can be created.
+func (m Model) visibleSelectItems() []string {
+	if m.selectFilter == "" {
+		return m.selectItems
+	}
+	var items []string
+	hasNew := false
+	for _, item := range m.selectItems {
+		if item == newContextItem {
+			hasNew = true
+		} else if fuzzyMatch(item, m.selectFilter) {
+			items = append(items, item)
+		}
+	}
+	if hasNew {
+		items = append(items, newContextItem)
+	}
+	return items
+}
+
 func (m Model) handleSelectKey(msg tea.KeyMsg, selectType string) (tea.Model, tea.Cmd) {
 	key := msg.String()
 
+	// Letters go to the filter; the actions below use ctrl keys in these pickers
+	if m.selectFilterable() {
+		switch {
+		case msg.Type == tea.KeyRunes && key != "?":
+			m.selectFilter += string(msg.Runes)
+			m.selectCursor = 0
+			return m, nil
+		case msg.Type == tea.KeyBackspace:
+			if len(m.selectFilter) > 0 {
+				m.selectFilter = m.selectFilter[:len(m.selectFilter)-1]
+				m.selectCursor = 0
+			}
+			return m, nil
+		}
+	}
+	items := m.visibleSelectItems()
+
 	switch key {
 	case "q", "ctrl+c", "esc":
 		m.mode = modeNormal
 		return m, nil
 
+	case "?":
+		return m.openHelp()
+
 	case "up", "k":
 		if m.selectCursor > 0 {
 			m.selectCursor--
 		}
 
 	case "down", "j":
-		if m.selectCursor < len(m.selectItems)-1 {
+		if m.selectCursor < len(items)-1 {
 			m.selectCursor++
 		}
 
-	case "D":
+	case "ctrl+l":
+		// Context size leaderboard (only for context select)
+		if selectType == "context" {
+			return m.enterContextSizes()
+		}
+
+	case "ctrl+f":
+		// Add/remove the cursor context as a favorite (jumped to with 1-9)
+		if selectType == "context" && m.selectCursor < len(items) && items[m.selectCursor] != newContextItem {
+			return m, m.toggleFavorite(items[m.selectCursor])
+		}
+
+	case "ctrl+r":
+		// Reset the cursor exclude rule's patterns to the defaults
+		if selectType == "exclude" && m.selectCursor < len(items) {
+			m.confirmResetExclude(items[m.selectCursor], modeExcludeSelect)
+			return m, nil
+		}
+
+	case "ctrl+a", "ctrl+t":
+		// Merge the cursor context into the active one (ctrl+t also appends its text)
+		if selectType == "context" && m.selectCursor < len(items) {
+			selected := items[m.selectCursor]
+			if selected != newContextItem && selected != m.context.Name {
+				m.mode = modeNormal
+				return m, m.mergeContext(selected, key == "ctrl+t")
+			}
+		}
+
+	case " ":
+		// Mark context for batch delete (only for context select)
+		if selectType == "context" && m.selectCursor < len(items) {
+			selected := items[m.selectCursor]
+			if selected != newContextItem && selected != "default" {
+				m.selectMarked[selected] = !m.selectMarked[selected]
+			}
+		}
+
+	case "ctrl+d":
 		// Delete context (only for context select, not exclude)
-		if selectType == "context" && m.selectCursor < len(m.selectItems) {
-			selected := m.selectItems[m.selectCursor]
+		if selectType == "context" {
+			var marked []string
+			for _, name := range m.selectItems {
+				if m.selectMarked[name] {
+					marked = append(marked, name)
+				}
+			}
+			if len(marked) > 0 {
+				m.confirmDeleteContexts(marked)
+				return m, nil
+			}
+		}
+		if selectType == "context" && m.selectCursor < len(items) {
+			selected := items[m.selectCursor]
 			// Don't allow deleting "[+] New context" or "default"
-			if selected != "[+] New context" && selected != "default" {
-				m.deleteTarget = selected
-				m.mode = modeConfirmDeleteCtx
+			if selected != newContextItem && selected != "default" {
+				m.confirmDeleteContext(selected, modeContextSelect)
 				return m, nil
 			}
 		}
 
 	case "enter":
-		if m.selectCursor < len(m.selectItems) {
-			selected := m.selectItems[m.selectCursor]
+		if m.selectCursor < len(items) {
+			selected := items[m.selectCursor]
 
 			if selectType == "context" {
-				if selected == "[+] New context" {
+				if selected == newContextItem {
+					// Start from whatever was typed into the filter
 					m.mode = modeNewContext
-					m.inputBuffer = ""
+					m.inputBuffer = m.selectFilter
 					return m, nil
 				}
 				// Switch context
 				ctx, err := LoadContext(selected)
 				if err != nil {
 					m.mode = modeNormal
-					return m, m.setStatus(fmt.Sprintf("Error: %v", err))
+					return m, m.setError("Error", err)
+				}
+				if selected != m.context.Name {
+					m.pushContextHistory(m.context.Name)
 				}
 				m.context = ctx
 				m.config.ActiveContext = selected
 				SaveConfig(m.config)
+				m.refreshExclude()
 				m.refreshFiles()
 				m.cursor = 0
+			} else if selectType == "backup" {
+				m.mode = modeNormal
+				return m, m.restoreBackup(selected)
+			} else if selectType == "template" {
+				m.mode = modeNormal
+				return m, m.createContext(m.newContextName, selected)
 			} else {
 				// Switch exclude
-				exc, err := LoadExcludeRule(selected)
-				if err != nil {
+				if _, err := LoadExcludeRule(selected); err != nil {
 					m.mode = modeNormal
-					return m, m.setStatus(fmt.Sprintf("Error: %v", err))
+					return m, m.setError("Error", err)
 				}
-				m.exclude = exc
 				m.config.ActiveExclude = selected
 				SaveConfig(m.config)
+				m.refreshExclude()
+			}
+		}
+		m.mode = modeNormal
+		return m, nil
+	}
+
+	return m, nil
+}
+
+func (m Model) handleNewContextKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.mode = modeNormal
+		return m, nil
+
+	case tea.KeyEnter:
+		m.mode = modeNormal
+		if m.inputBuffer == "" {
+			return m, nil
+		}
+
+		// Let the user pick a template first, if there are any
+		templates, _ := ListTemplates()
+		if len(templates) > 0 {
+			m.newContextName = m.inputBuffer
+			m.selectItems = append([]string{blankTemplate}, templates...)
+			m.selectCursor = 0
+			m.selectFilter = ""
+			m.mode = modeTemplateSelect
+			return m, nil
+		}
+		return m, m.createContext(m.inputBuffer, blankTemplate)
+
+	case tea.KeyBackspace:
+		if len(m.inputBuffer) > 0 {
+			m.inputBuffer = m.inputBuffer[:len(m.inputBuffer)-1]
+		}
+
+	case tea.KeyRunes:
+		m.inputBuffer += string(msg.Runes)
+	}
+
+	return m, nil
+}
+
+// createContext creates a context seeded from the named template (or blank) and switches to it
+func (m *Model) createContext(name string, template string) tea.Cmd {
+	ctx := Context{
+		Name:           name,
+		ProjectContext: "",
+		Request:        "",
+		Files:          []string{},
+	}
+	if template != blankTemplate {
+		tmpl, err := LoadTemplate(template)
+		if err != nil {
+			return m.setError("Error", err)
+		}
+		tmpl.Apply(&ctx)
+	}
+	if err := SaveContext(ctx); err != nil {
+		return m.setError("Error", err)
+	}
+
+	// Switch to it
+	m.pushContextHistory(m.context.Name)
+	m.context = ctx
+	m.config.ActiveContext = name
+	SaveConfig(m.config)
+	m.refreshExclude()
+	m.refreshFiles()
+	m.cursor = 0
+	if template != blankTemplate {
+		return m.setStatus(fmt.Sprintf("Created context: %s (from template %s)", name, template))
+	}
+	return m.setStatus(fmt.Sprintf("Created context: %s", name))
+}
+
+func (m Model) handleAddFileKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.mode = modeNormal
+		return m, nil
+
+	case tea.KeyEnter:
+		if m.inputBuffer != "" {
+			cmd := m.processPaste(m.inputBuffer)
+			m.inputBuffer = ""
+			m.mode = modeNormal
+			return m, cmd
+		}
+		m.mode = modeNormal
+		return m, nil
+
+	case tea.KeyBackspace:
+		if len(m.inputBuffer) > 0 {
+			m.inputBuffer = m.inputBuffer[:len(m.inputBuffer)-1]
+		}
+
+	case tea.KeyRunes:
+		// This handles both single chars and pasted text
+		m.inputBuffer += string(msg.Runes)
+	}
+
+	return m, nil
+}
+
+func (m Model) handleExcludeTestKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.mode = modeNormal
+		return m, nil
+
+	case tea.KeyEnter:
+		dir := expandPath(strings.TrimSpace(m.inputBuffer))
+		if dir == "" {
+			m.mode = modeNormal
+			return m, nil
+		}
+		result, err := TestExcludeRule(dir, &m.exclude)
+		if err != nil {
+			m.mode = modeNormal
+			return m, m.setError("Error", err)
+		}
+		m.excludeTest = result
+		m.mode = modeExcludeTestResult
+		return m, nil
+
+	case tea.KeyBackspace:
+		if len(m.inputBuffer) > 0 {
+			m.inputBuffer = m.inputBuffer[:len(m.inputBuffer)-1]
+		}
+
+	case tea.KeyRunes:
+		m.inputBuffer += string(msg.Runes)
+	}
+
+	return m, nil
+}
+
+func (m Model) handleEditPathKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.mode = modeNormal
+		return m, nil
+
+	case tea.KeyEnter:
+		m.mode = modeNormal
+		input := strings.TrimSpace(m.inputBuffer)
+		if input == "" || input == m.editPathOrig {
+			return m, nil
+		}
+
+		path, ok := resolveInputPath(input, m.projectRoot())
+		if !ok {
+			return m, m.setStatus("Not a valid path")
+		}
+		stat, err := os.Stat(path)
+		if err != nil {
+			return m, m.setStatus(fmt.Sprintf("File not found: %s", path))
+		}
+		if stat.IsDir() {
+			return m, m.setStatus("Path is a directory")
+		}
+
+		if !m.context.RenameFile(m.editPathOrig, path) {
+			return m, m.setStatus("File already in context")
+		}
+		if err := SaveContext(m.context); err != nil {
+			return m, m.setError("Error saving", err)
+		}
+		m.refreshFiles()
+
+		// Keep the cursor on the edited file
+		for i, f := range m.files {
+			if f.Path == path {
+				m.cursor = i
+				break
+			}
+		}
+		return m, m.setStatus("Updated path")
+
+	case tea.KeyBackspace:
+		if len(m.inputBuffer) > 0 {
+			m.inputBuffer = m.inputBuffer[:len(m.inputBuffer)-1]
+		}
+
+	case tea.KeyRunes, tea.KeySpace:
+		m.inputBuffer += string(msg.Runes)
+	}
+
+	return m, nil
+}
+
+func (m Model) handleEditNoteKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.mode = modeNormal
+		return m, nil
+
+	case tea.KeyEnter:
+		m.mode = modeNormal
+		note := strings.TrimSpace(m.inputBuffer)
+		if note == m.context.Notes[m.editPathOrig] {
+			return m, nil
+		}
+		m.context.SetNote(m.editPathOrig, note)
+		if err := SaveContext(m.context); err != nil {
+			return m, m.setError("Error saving", err)
+		}
+		if note == "" {
+			return m, m.setStatus("Note removed")
+		}
+		return m, m.setStatus("Note saved")
+
+	case tea.KeyBackspace:
+		if len(m.inputBuffer) > 0 {
+			m.inputBuffer = m.inputBuffer[:len(m.inputBuffer)-1]
+		}
+
+	case tea.KeyRunes, tea.KeySpace:
+		m.inputBuffer += string(msg.Runes)
+	}
+
+	return m, nil
+}
+
+func (m Model) handleContextFromFileKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.mode = modeNormal
+		return m, nil
+
+	case tea.KeyEnter:
+		m.mode = modeNormal
+		input := strings.TrimSpace(m.inputBuffer)
+		if input == "" {
+			return m, nil
+		}
+
+		// Split off an optional #Section heading
+		file, section, _ := strings.Cut(input, "#")
+		path, ok := resolveInputPath(strings.TrimSpace(file), m.projectRoot())
+		if !ok {
+			return m, m.setStatus("Not a valid path")
+		}
+
+		ctx := m.context
+		ctx.ProjectContextFile = path
+		ctx.ProjectContextSection = strings.TrimSpace(section)
+		if err := ctx.SyncProjectContext(); err != nil {
+			return m, m.setError("Error", err)
+		}
+		m.context = ctx
+		if err := SaveContext(m.context); err != nil {
+			return m, m.setError("Error saving", err)
+		}
+		return m, m.setStatus("Project context set from " + input)
+
+	case tea.KeyBackspace:
+		if len(m.inputBuffer) > 0 {
+			m.inputBuffer = m.inputBuffer[:len(m.inputBuffer)-1]
+		}
+
+	case tea.KeyRunes, tea.KeySpace:
+		m.inputBuffer += string(msg.Runes)
+	}
+
+	return m, nil
+}
+
+func (m Model) handleAddDirListKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.mode = modeNormal
+		return m, nil
+
+	case tea.KeyEnter:
+		m.mode = modeNormal
+		input := strings.TrimSpace(m.inputBuffer)
+		if input == "" {
+			return m, nil
+		}
+		path, ok := resolveInputPath(input, m.projectRoot())
+		if !ok {
+			return m, m.setStatus("Not a valid path")
+		}
+		return m, m.addDirList(path)
+
+	case tea.KeyBackspace:
+		if len(m.inputBuffer) > 0 {
+			m.inputBuffer = m.inputBuffer[:len(m.inputBuffer)-1]
+		}
+
+	case tea.KeyRunes, tea.KeySpace:
+		m.inputBuffer += string(msg.Runes)
+	}
+
+	return m, nil
+}
+
+func (m Model) handleExportHistoryKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.mode = modeNormal
+		return m, nil
+
+	case tea.KeyEnter:
+		m.mode = modeNormal
+		return m, m.exportHistory(strings.TrimSpace(m.inputBuffer))
+
+	case tea.KeyBackspace:
+		if len(m.inputBuffer) > 0 {
+			m.inputBuffer = m.inputBuffer[:len(m.inputBuffer)-1]
+		}
+
+	case tea.KeyRunes, tea.KeySpace:
+		m.inputBuffer += string(msg.Runes)
+	}
+
+	return m, nil
+}
+
+// exportHistory writes every history entry to path as one document (JSON if path
+// ends in .json, else YAML), or copies the YAML to the clipboard if path is empty
+func (m *Model) exportHistory(path string) tea.Cmd {
+	if path != "" {
+		path = expandPath(path)
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+	}
+
+	data, n, err := ExportHistory(strings.EqualFold(filepath.Ext(path), ".json"))
+	if err != nil {
+		return m.setError("Error", err)
+	}
+
+	if path == "" {
+		if err := CopyToClipboard(string(data), m.config.VerifyClipboard); err != nil {
+			return m.setClipboardError(err)
+		}
+		return m.setStatus(fmt.Sprintf("Copied %d history entries (%s)", n, formatSize(int64(len(data)))))
+	}
+
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return m.setError("Error writing", err)
+	}
+	return m.setStatus(fmt.Sprintf("Exported %d history entries to %s", n, m.showPath(path)))
+}
+
+// gitDir returns the directory git commands run in: the project root, or the
+// working directory without one
+func (m Model) gitDir() string {
+	if root := m.projectRoot(); root != "" {
+		return root
+	}
+	wd, _ := os.Getwd()
+	return wd
+}
+
+// promptGitDiff returns the uncommitted changes for the prompt's <git_diff> section,
+// or "" when include_git_diff is off or the directory isn't a git repository
+func promptGitDiff(cfg Config, dir string) string {
+	if !cfg.IncludeGitDiff || dir == "" {
+		return ""
+	}
+	diff, err := GitDiff(dir)
+	if err != nil {
+		return ""
+	}
+	return diff
+}
+
+// addGitChanges adds the files with uncommitted git changes in the project root
+// (or the working directory) to the context
+func (m *Model) addGitChanges() tea.Cmd {
+	added, changed, err := m.context.AddGitChanges(m.gitDir(), &m.exclude)
+	if err != nil {
+		return m.setError("Error", err)
+	}
+	if added > 0 {
+		if err := SaveContext(m.context); err != nil {
+			return m.setError("Error saving", err)
+		}
+		m.refreshFiles()
+	}
+	return m.setStatus(fmt.Sprintf("%d changed files, added %d", changed, added))
+}
+
+// addDirList expands every directory listed (one per line) in the file at path
+// with the active exclude rule and adds the results to the context. Blank lines
+// and lines starting with # are ignored; relative paths resolve against the project root.
+func (m *Model) addDirList(path string) tea.Cmd {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return m.setError("Error reading", err)
+	}
+
+	total := 0
+	var counts, failed []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		dir, ok := resolveInputPath(line, m.projectRoot())
+		if !ok {
+			failed = append(failed, line)
+			continue
+		}
+		files, err := ExpandDirectory(dir, &m.exclude, m.config.MaxExpandDepth)
+		if err != nil {
+			failed = append(failed, line)
+			continue
+		}
+
+		added := 0
+		for _, f := range files {
+			if m.context.AddFile(f) {
+				added++
 			}
 		}
-		m.mode = modeNormal
-		return m, nil
+		total += added
+		counts = append(counts, fmt.Sprintf("%s: %d", filepath.Base(dir), added))
 	}
 
-	return m, nil
+	if total > 0 {
+		if err := SaveContext(m.context); err != nil {
+			return m.setError("Error saving", err)
+		}
+		m.refreshFiles()
+	}
+
+	msg := fmt.Sprintf("Added %d files from %d directories", total, len(counts))
+	if len(counts) > 0 {
+		msg += " (" + strings.Join(counts, ", ") + ")"
+	}
+	if len(failed) > 0 {
+		msg += fmt.Sprintf("; skipped %d: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return m.setStatus(msg)
 }
 
-func (m Model) handleNewContextKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+// syncProjectContext re-reads the project context from its source file
+func (m *Model) syncProjectContext() tea.Cmd {
+	if err := m.context.SyncProjectContext(); err != nil {
+		return m.setError("Error", err)
+	}
+	if err := SaveContext(m.context); err != nil {
+		return m.setError("Error saving", err)
+	}
+	return m.setStatus("Project context synced from " + displayPath(m.context.ProjectContextFile, m.projectRoot()))
+}
+
+func (m Model) handleProjectRootKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.Type {
 	case tea.KeyEsc:
 		m.mode = modeNormal
 		return m, nil
 
 	case tea.KeyEnter:
-		if m.inputBuffer != "" {
-			// Create new context
-			ctx := Context{
-				Name:           m.inputBuffer,
-				ProjectContext: "",
-				Request:        "",
-				Files:          []string{},
-			}
-			if err := SaveContext(ctx); err != nil {
-				m.mode = modeNormal
-				return m, m.setStatus(fmt.Sprintf("Error: %v", err))
+		m.mode = modeNormal
+		root := expandPath(strings.TrimSpace(m.inputBuffer))
+		if root != "" {
+			abs, err := filepath.Abs(root)
+			if err != nil {
+				return m, m.setError("Error", err)
+			}
+			root = abs
+			stat, err := os.Stat(root)
+			if err != nil || !stat.IsDir() {
+				return m, m.setStatus("Not a directory: " + root)
 			}
-			// Switch to it
-			m.context = ctx
-			m.config.ActiveContext = m.inputBuffer
-			SaveConfig(m.config)
-			m.refreshFiles()
-			m.cursor = 0
-			m.mode = modeNormal
-			return m, m.setStatus(fmt.Sprintf("Created context: %s", m.inputBuffer))
 		}
-		m.mode = modeNormal
-		return m, nil
+
+		m.context.ProjectRoot = root
+		if err := SaveContext(m.context); err != nil {
+			return m, m.setError("Error saving", err)
+		}
+		m.refreshExclude() // root-relative patterns follow the new root
+		if root == "" {
+			return m, m.setStatus("Cleared project root")
+		}
+		return m, m.setStatus("Project root: " + root)
 
 	case tea.KeyBackspace:
 		if len(m.inputBuffer) > 0 {
 			m.inputBuffer = m.inputBuffer[:len(m.inputBuffer)-1]
 		}
 
-	case tea.KeyRunes:
+	case tea.KeyRunes, tea.KeySpace:
 		m.inputBuffer += string(msg.Runes)
 	}
 
 	return m, nil
 }
 
-func (m Model) handleAddFileKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+func (m Model) handleShowConfigKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "e":
+		return m.openSkipPrefixes()
+	case "o":
+		m.mode = modeNormal
+		return m, m.openConfigDir()
+	}
+	m.mode = modeNormal
+	return m, nil
+}
+
+// openConfigDir opens the config directory in the system file manager, with
+// the TUI suspended until the opener returns
+func (m *Model) openConfigDir() tea.Cmd {
+	dir, err := ConfigDir()
+	if err != nil {
+		return m.setError("Error", err)
+	}
+	shown := m.showPath(dir)
+	cmd, err := openCommand(dir)
+	if err != nil {
+		return m.setError("Can't open "+shown, err)
+	}
+	return tea.ExecProcess(cmd, func(err error) tea.Msg {
+		if err != nil {
+			return errorMsg{status: fmt.Sprintf("Error opening %s: %v", shown, err), err: err}
+		}
+		return statusMsg("Opened " + shown)
+	})
+}
+
+// openSkipPrefixes starts editing skip_prefixes, prefilled with the current ones.
+// When .ctx.yaml sets them the edit is refused, since only the global config is saved.
+func (m Model) openSkipPrefixes() (tea.Model, tea.Cmd) {
+	if m.config.project != nil && len(m.config.project.SkipPrefixes) > 0 {
+		return m, m.setStatus("skip_prefixes is set by " + m.showPath(m.config.ProjectConfig) + "; edit it there")
+	}
+	m.mode = modeSkipPrefixes
+	m.inputBuffer = strings.Join(m.config.SkipPrefixes, " ")
+	return m, nil
+}
+
+// parseSkipPrefixes splits a space- or comma-separated list of prefixes
+func parseSkipPrefixes(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
+func (m Model) handleSkipPrefixesKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.Type {
 	case tea.KeyEsc:
-		m.mode = modeNormal
+		m.mode = modeShowConfig
 		return m, nil
 
 	case tea.KeyEnter:
-		if m.inputBuffer != "" {
-			cmd := m.processPaste(m.inputBuffer)
-			m.inputBuffer = ""
-			m.mode = modeNormal
-			return m, cmd
+		m.mode = modeShowConfig
+		prefixes := parseSkipPrefixes(m.inputBuffer)
+		if len(prefixes) == 0 {
+			prefixes = DefaultConfig().SkipPrefixes
 		}
-		m.mode = modeNormal
-		return m, nil
+
+		m.config.SkipPrefixes = prefixes
+		if err := SaveConfig(m.config); err != nil {
+			return m, m.setError("Error saving config", err)
+		}
+		m.refreshFiles()
+		return m, m.setStatus(fmt.Sprintf("Saved %d skip prefixes", len(prefixes)))
 
 	case tea.KeyBackspace:
 		if len(m.inputBuffer) > 0 {
 			m.inputBuffer = m.inputBuffer[:len(m.inputBuffer)-1]
 		}
 
-	case tea.KeyRunes:
-		// This handles both single chars and pasted text
+	case tea.KeyRunes, tea.KeySpace:
 		m.inputBuffer += string(msg.Runes)
 	}
 
 	return m, nil
 }
 
-func (m Model) handleShowConfigKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	m.mode = modeNormal
-	return m, nil
-}
-
 func (m *Model) processPaste(input string) tea.Cmd {
 	input = strings.TrimSpace(input)
 	if input == "" {
 		return nil
 	}
 
-	// Check if it's an absolute path
-	if !strings.HasPrefix(input, "/") {
+	// Expand ~ and environment variables, resolve relative paths against the project root
+	path, ok := resolveInputPath(input, m.projectRoot())
+
+	// Only a path that doesn't exist as written is a glob (app/[id]/page.tsx is a file)
+	if HasGlobMeta(input) && (!ok || !fileExists(path)) {
+		return m.addGlob(input)
+	}
+	if !ok {
 		return m.setStatus("Not a valid path")
 	}
+	input = path
 
 	// Check if path exists
 	stat, err := os.Stat(input)
@@ -871,32 +2779,27 @@ func (m *Model) processPaste(input string) tea.Cmd {
 		return m.setStatus(fmt.Sprintf("Path not found: %s", input))
 	}
 
-	if stat.IsDir() {
-		// Expand directory
-		files, err := ExpandDirectory(input, &m.exclude)
-		if err != nil {
-			return m.setStatus(fmt.Sprintf("Error expanding: %v", err))
-		}
-
-		added := 0
-		for _, f := range files {
-			if m.context.AddFile(f) {
-				added++
-			}
-		}
+	added, err := m.context.AddPath(input, &m.exclude, m.config.MaxExpandDepth)
+	if err != nil {
+		return m.setError("Error expanding", err)
+	}
 
+	if stat.IsDir() {
 		if err := SaveContext(m.context); err != nil {
-			return m.setStatus(fmt.Sprintf("Error saving: %v", err))
+			return m.setError("Error saving", err)
 		}
 
 		m.refreshFiles()
+		if m.config.MaxExpandDepth > 0 {
+			return m.setStatus(fmt.Sprintf("Added %d files from directory (max_expand_depth %d)", added, m.config.MaxExpandDepth))
+		}
 		return m.setStatus(fmt.Sprintf("Added %d files from directory", added))
 	}
 
 	// Single file
-	if m.context.AddFile(input) {
+	if added > 0 {
 		if err := SaveContext(m.context); err != nil {
-			return m.setStatus(fmt.Sprintf("Error saving: %v", err))
+			return m.setError("Error saving", err)
 		}
 		m.refreshFiles()
 		return m.setStatus("File added")
@@ -905,214 +2808,675 @@ func (m *Model) processPaste(input string) tea.Cmd {
 	return m.setStatus("Already in context")
 }
 
-func (m *Model) yank() tea.Cmd {
-	var sb strings.Builder
+// addGlob adds every file matching a glob pattern (filtered by the exclude rule)
+func (m *Model) addGlob(pattern string) tea.Cmd {
+	pattern = expandPath(pattern)
+	if !strings.HasPrefix(pattern, "/") {
+		if m.projectRoot() == "" {
+			return m.setStatus("Not a valid path")
+		}
+		pattern = filepath.Join(m.projectRoot(), pattern)
+	}
+
+	files, err := ExpandGlob(pattern, &m.exclude)
+	if err != nil {
+		return m.setError("Invalid pattern", err)
+	}
 
-	// Write preamble explaining the structure
-	sb.WriteString(`This is a structured prompt for a software development task.
+	added := 0
+	for _, f := range files {
+		if m.context.AddFile(f) {
+			added++
+		}
+	}
+
+	if added > 0 {
+		if err := SaveContext(m.context); err != nil {
+			return m.setError("Error saving", err)
+		}
+		m.refreshFiles()
+	}
+
+	return m.setStatus(fmt.Sprintf("Matched %d files, added %d", len(files), added))
+}
 
-<project_context> describes the project: its purpose, tech stack, architecture, and coding conventions. Use this to understand the broader context.
+// resolveInputPath expands ~ and environment variables in a user-supplied path and
+// resolves relative paths against root. Returns false if the path is relative and
+// no root is configured or the resolved path doesn't exist.
+func resolveInputPath(path string, root string) (string, bool) {
+	path = expandPath(path)
+	if strings.HasPrefix(path, "/") {
+		return path, true
+	}
 
-<request> contains the specific task or question to address. This is what you should focus on accomplishing.
+	if root == "" {
+		return "", false
+	}
 
-<file> tags contain the relevant source files. Each file has a path attribute. Use these to understand the current implementation and make appropriate changes.
+	resolved := filepath.Join(root, path)
+	if _, err := os.Stat(resolved); err != nil {
+		return "", false
+	}
 
----
+	return resolved, true
+}
 
-`)
+// expandPath resolves a leading ~ to the home directory and expands $VAR/${VAR}
+func expandPath(path string) string {
+	path = os.ExpandEnv(path)
 
-	// Write project context
-	if m.context.ProjectContext != "" {
-		sb.WriteString("<project_context>\n")
-		sb.WriteString(m.context.ProjectContext)
-		if !strings.HasSuffix(m.context.ProjectContext, "\n") {
-			sb.WriteString("\n")
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return path
 		}
-		sb.WriteString("</project_context>\n\n")
+		path = filepath.Join(home, strings.TrimPrefix(path, "~"))
 	}
 
-	// Write request
-	if m.context.Request != "" {
-		sb.WriteString("<request>\n")
-		sb.WriteString(m.context.Request)
-		if !strings.HasSuffix(m.context.Request, "\n") {
-			sb.WriteString("\n")
+	return path
+}
+
+// yank copies the prompt to the clipboard, asking for confirmation first if the
+// total size exceeds the configured budget
+func (m *Model) yank() tea.Cmd {
+	budget := m.config.ContextBudgetBytes
+	total := m.totalSize()
+	if budget <= 0 || total <= budget {
+		return m.yankNow()
+	}
+
+	// List the largest files so the user can cancel and trim
+	largest := make([]FileInfo, len(m.files))
+	copy(largest, m.files)
+	sort.Slice(largest, func(i, j int) bool {
+		return largest[i].Size > largest[j].Size
+	})
+
+	lines := []string{
+		fmt.Sprintf("Total size %s exceeds the budget of %s.", formatSize(total), formatSize(budget)),
+		"",
+		"Largest files:",
+	}
+	for i, f := range largest {
+		if i >= 5 {
+			break
 		}
-		sb.WriteString("</request>\n\n")
+		lines = append(lines, fmt.Sprintf("  %8s  %s", formatSize(f.Size), f.RelPath))
+	}
+	lines = append(lines, "", "Copy anyway?")
+
+	m.askConfirm(confirmPrompt{
+		title:      "Over Budget",
+		lines:      lines,
+		cancelMode: modeNormal,
+		onConfirm: func(m *Model) tea.Cmd {
+			return m.yankNow()
+		},
+	})
+	return nil
+}
+
+// yankNow starts building the prompt in the background; the result is copied to
+// the clipboard and saved to history, reporting progress as files are read
+func (m *Model) yankNow() tea.Cmd {
+	if m.yanking {
+		return m.setStatus("Yank already in progress")
 	}
 
-	// Check for missing files
+	// Check for missing files (disabled ones aren't read)
 	var missing []string
 	for _, f := range m.files {
-		if !f.Exists {
+		if !f.Exists && !f.Disabled {
 			missing = append(missing, f.Path)
 		}
 	}
 
 	if len(missing) > 0 {
+		m.quitAfterYank = false
 		return m.setStatus(fmt.Sprintf("Warning: %d file(s) missing", len(missing)))
 	}
 
-	// Write files
-	for _, f := range m.files {
-		if !f.Exists {
-			continue
+	filePaths, skipped := m.yankablePaths()
+	disabled := m.disabledPaths()
+
+	cfg := m.config
+	ctx := m.context
+	root := m.projectRoot()
+	gitDir := m.gitDir()
+	cache := m.cache
+	updates := make(chan tea.Msg, 1)
+
+	go func() {
+		start := time.Now()
+
+		// Record mtimes before reading so edits made during the yank count as changes
+		mtimes := make(map[string]time.Time, len(filePaths))
+		for _, path := range filePaths {
+			if stat, err := os.Stat(path); err == nil {
+				mtimes[path] = stat.ModTime()
+			}
 		}
 
-		content, err := os.ReadFile(f.Path)
-		if err != nil {
+		prompt, included := buildPromptFiles(cfg, promptInput{
+			ProjectContext: ctx.ProjectContext,
+			Request:        ctx.Request,
+			ProjectRoot:    root,
+			Files:          filePaths,
+			Notes:          ctx.Notes,
+			GitDiff:        promptGitDiff(cfg, gitDir),
+			Cache:          cache,
+			Progress: func(done, total int) {
+				// Drop the update if the UI hasn't picked up the previous one yet
+				select {
+				case updates <- yankProgressMsg{done: done, total: total, updates: updates}:
+				default:
+				}
+			},
+		})
+
+		// Copy to clipboard
+		if err := CopyToClipboard(prompt, cfg.VerifyClipboard); err != nil {
+			updates <- yankDoneMsg{err: err}
+			return
+		}
+		elapsed := time.Since(start)
+
+		// Save to history
+		totalBytes := int64(len(prompt))
+		entry := HistoryEntry{
+			Timestamp:      time.Now(),
+			ContextName:    ctx.Name,
+			ProjectContext: ctx.ProjectContext,
+			Request:        ctx.Request,
+			Files:          included,
+			DisabledFiles:  disabled,
+			Notes:          ctx.Notes,
+			FileCount:      len(included),
+			TotalBytes:     totalBytes,
+			EstTokens:      estimateTokens(totalBytes),
+		}
+		SaveHistoryEntry(entry, cfg) // Ignore error - don't fail yank if history fails
+
+		updates <- yankDoneMsg{context: ctx.Name, source: ctx.SourcePath, mtimes: mtimes, files: len(included), skipped: skipped, elapsed: elapsed}
+	}()
+
+	m.yanking = true
+	m.yankDone = 0
+	m.yankTotal = len(filePaths)
+	return tea.Batch(waitForYank(updates), m.spinner.Tick)
+}
+
+// yankablePaths returns the paths of the files to include in a yank, leaving out
+// disabled files and symlinks to oversized targets, and how many symlinks were left out
+func (m Model) yankablePaths() ([]string, int) {
+	var paths []string
+	skipped := 0
+	for _, f := range m.allFiles {
+		if f.Disabled {
+			continue
+		}
+		if f.Oversize {
+			skipped++
 			continue
 		}
+		paths = append(paths, f.Path)
+	}
+	return paths, skipped
+}
 
-		// Use relative path if project_root is set
-		displayPath := f.Path
-		if m.context.ProjectRoot != "" {
-			root := m.context.ProjectRoot
-			if !strings.HasSuffix(root, "/") {
-				root += "/"
-			}
-			if strings.HasPrefix(f.Path, root) {
-				displayPath = strings.TrimPrefix(f.Path, root)
-			}
+// disabledPaths returns the paths of the disabled files, in display order
+func (m Model) disabledPaths() []string {
+	var paths []string
+	for _, f := range m.allFiles {
+		if f.Disabled {
+			paths = append(paths, f.Path)
 		}
+	}
+	return paths
+}
 
-		sb.WriteString(fmt.Sprintf("<file path=\"%s\">\n", displayPath))
-		sb.Write(content)
-		if len(content) > 0 && content[len(content)-1] != '\n' {
-			sb.WriteString("\n")
+// recordYankMtimes saves the file mtimes of a successful yank to the yanked context
+// (the stored context name, or the file source if it was opened from one), clearing
+// its changed markers
+func (m *Model) recordYankMtimes(name, source string, mtimes map[string]time.Time) {
+	if name != m.context.Name || source != m.context.SourcePath {
+		// Context was switched during the yank
+		var ctx Context
+		var err error
+		if source != "" {
+			ctx, err = LoadContextFromPath(source)
+		} else {
+			ctx, err = LoadContext(name)
+		}
+		if err == nil {
+			ctx.YankedMtimes = mtimes
+			SaveContext(ctx)
+		}
+		return
+	}
+
+	m.context.YankedMtimes = mtimes
+	SaveContext(m.context)
+	// In missing-only mode files is a separate slice, not a view of allFiles
+	for i := range m.allFiles {
+		m.allFiles[i].Changed = false
+	}
+	for i := range m.files {
+		m.files[i].Changed = false
+	}
+}
+
+// waitForYank returns a command that waits for the next message from a background yank
+func waitForYank(updates <-chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		return <-updates
+	}
+}
+
+func (m *Model) yankHistoryEntry() tea.Cmd {
+	if len(m.historyEntries) == 0 || m.historyCursor >= len(m.historyEntries) {
+		return m.setStatus("No history entry selected")
+	}
+
+	entry := m.historyEntries[m.historyCursor]
+
+	// Files are re-read from disk
+	prompt := buildPrompt(m.config, promptInput{
+		ProjectContext: entry.ProjectContext,
+		Request:        entry.Request,
+		Files:          entry.Files,
+		Notes:          entry.Notes,
+	})
+
+	// Copy to clipboard
+	if err := CopyToClipboard(prompt, m.config.VerifyClipboard); err != nil {
+		return m.setClipboardError(err)
+	}
+
+	return m.setStatus(fmt.Sprintf("Yanked history entry (%d files)", len(entry.Files)))
+}
+
+// toggleFilePin pins or unpins the cursor file, keeping the cursor on it
+func (m *Model) toggleFilePin() tea.Cmd {
+	if m.cursor >= len(m.files) {
+		return nil
+	}
+
+	path := m.files[m.cursor].Path
+	pinned := m.context.TogglePin(path)
+	if err := SaveContext(m.context); err != nil {
+		return m.setError("Error saving", err)
+	}
+	m.refreshFiles()
+	m.jumpToFile(slices.IndexFunc(m.files, func(f FileInfo) bool { return f.Path == path }))
+
+	if pinned {
+		return m.setStatus("Pinned " + displayPath(path, m.projectRoot()))
+	}
+	return m.setStatus("Unpinned " + displayPath(path, m.projectRoot()))
+}
+
+// toggleFileDisabled disables the cursor file (left out of yanks, but kept in the
+// list) or re-enables it
+func (m *Model) toggleFileDisabled() tea.Cmd {
+	if m.cursor >= len(m.files) {
+		return nil
+	}
+
+	path := m.files[m.cursor].Path
+	disabled := m.context.ToggleDisabled(path)
+	if err := SaveContext(m.context); err != nil {
+		return m.setError("Error saving", err)
+	}
+	m.refreshFiles()
+	m.jumpToFile(slices.IndexFunc(m.files, func(f FileInfo) bool { return f.Path == path }))
+
+	if disabled {
+		return m.setStatus("Disabled " + displayPath(path, m.projectRoot()) + " (left out of yanks)")
+	}
+	return m.setStatus("Enabled " + displayPath(path, m.projectRoot()))
+}
+
+// loadHistoryEntries reads the history list from disk in the current display order
+func (m *Model) loadHistoryEntries() {
+	entries, _ := ListHistoryEntries()
+	if m.historyOldestFirst {
+		slices.Reverse(entries)
+	}
+	m.historyEntries = entries
+}
+
+// toggleHistoryOrder reverses the displayed history order in place, keeping the
+// cursor and diff base on the same entries
+func (m *Model) toggleHistoryOrder() tea.Cmd {
+	m.historyOldestFirst = !m.historyOldestFirst
+	slices.Reverse(m.historyEntries)
+
+	n := len(m.historyEntries)
+	if n > 0 {
+		m.historyCursor = n - 1 - m.historyCursor
+		if m.historyBase >= 0 {
+			m.historyBase = n - 1 - m.historyBase
+		}
+
+		// Mirror the scroll window, then make sure the cursor is in it
+		visibleRows := m.visibleFileRows()
+		m.historyOffset = max(n-m.historyOffset-visibleRows, 0)
+		if m.historyCursor < m.historyOffset {
+			m.historyOffset = m.historyCursor
+		} else if m.historyCursor >= m.historyOffset+visibleRows {
+			m.historyOffset = m.historyCursor - visibleRows + 1
+		}
+	}
+
+	return m.setStatus("History: " + m.historyOrderName())
+}
+
+// historyOrderName describes the current history display order
+func (m Model) historyOrderName() string {
+	if m.historyOldestFirst {
+		return "oldest first"
+	}
+	return "newest first"
+}
+
+func (m *Model) toggleHistoryPin() tea.Cmd {
+	if len(m.historyEntries) == 0 || m.historyCursor >= len(m.historyEntries) {
+		return m.setStatus("No history entry selected")
+	}
+
+	entry := &m.historyEntries[m.historyCursor]
+	entry.Pinned = !entry.Pinned
+	if err := UpdateHistoryEntry(*entry); err != nil {
+		entry.Pinned = !entry.Pinned
+		return m.setError("Error saving", err)
+	}
+
+	if entry.Pinned {
+		return m.setStatus("Pinned history entry")
+	}
+	return m.setStatus("Unpinned history entry")
+}
+
+func (m *Model) deleteSelected() tea.Cmd {
+	selected := m.selectedCount()
+
+	if selected > 0 {
+		// Delete all selected
+		var toRemove []string
+		for _, f := range m.files {
+			if f.Selected {
+				toRemove = append(toRemove, f.Path)
+			}
 		}
-		sb.WriteString("</file>\n\n")
+		backupContext(m.context)
+		m.context.RemoveFiles(toRemove)
+	} else if m.cursor < len(m.files) {
+		// Delete cursor item
+		m.context.RemoveFile(m.files[m.cursor].Path)
+	}
+
+	if err := SaveContext(m.context); err != nil {
+		return m.setError("Error saving", err)
+	}
+
+	m.refreshFiles()
+
+	// Adjust cursor if needed
+	if m.cursor >= len(m.files) && m.cursor > 0 {
+		m.cursor = len(m.files) - 1
+	}
+
+	if selected > 0 {
+		return m.setStatus(fmt.Sprintf("Deleted %d files", selected))
 	}
+	return m.setStatus("Deleted file")
+}
 
-	// Copy to clipboard
-	if err := CopyToClipboard(sb.String()); err != nil {
-		return m.setStatus(fmt.Sprintf("Clipboard error: %v", err))
+// excludeCursorExtension asks to add a **/*.<ext> pattern for the cursor file's
+// extension to the effective exclude rule and to remove matching files from the context
+func (m *Model) excludeCursorExtension() tea.Cmd {
+	if m.cursor >= len(m.files) {
+		return m.setStatus("No file selected")
+	}
+	ext := filepath.Ext(m.files[m.cursor].Path)
+	if ext == "" {
+		return m.setStatus("File has no extension")
 	}
+	pattern := "**/*" + ext
 
-	// Save to history
-	var filePaths []string
+	var matching []string
 	for _, f := range m.files {
-		filePaths = append(filePaths, f.Path)
-	}
-	entry := HistoryEntry{
-		Timestamp:      time.Now(),
-		ContextName:    m.context.Name,
-		ProjectContext: m.context.ProjectContext,
-		Request:        m.context.Request,
-		Files:          filePaths,
+		if filepath.Ext(f.Path) == ext {
+			matching = append(matching, f.Path)
+		}
 	}
-	SaveHistoryEntry(entry) // Ignore error - don't fail yank if history fails
 
-	return m.setStatus(fmt.Sprintf("Yanked %d files to clipboard", len(m.files)))
+	m.confirmExcludePattern("Exclude Extension", pattern, matching, modeNormal)
+	return nil
 }
 
-func (m *Model) yankHistoryEntry() tea.Cmd {
-	if len(m.historyEntries) == 0 || m.historyCursor >= len(m.historyEntries) {
-		return m.setStatus("No history entry selected")
-	}
-
-	entry := m.historyEntries[m.historyCursor]
-
-	var sb strings.Builder
+// confirmExcludePattern asks before appending pattern to the effective exclude rule
+// and removing the matching files from the context. The view returns to returnMode.
+func (m *Model) confirmExcludePattern(title string, pattern string, matching []string, returnMode mode) {
+	ruleName := m.exclude.Name
+	m.askConfirm(confirmPrompt{
+		title: title,
+		lines: []string{
+			fmt.Sprintf("Add %s to exclude rule '%s'?", pattern, ruleName),
+			fmt.Sprintf("This removes %d matching file(s) from the context.", len(matching)),
+		},
+		warning:    "The rule may be shared with other contexts.",
+		cancelMode: returnMode,
+		onConfirm: func(m *Model) tea.Cmd {
+			m.mode = returnMode
+
+			exc, err := LoadExcludeRule(ruleName)
+			if err != nil {
+				return m.setError("Error", err)
+			}
+			if exc.AddPattern(pattern) {
+				if err := SaveExcludeRule(exc); err != nil {
+					return m.setError("Error saving", err)
+				}
+			}
+			m.refreshExclude()
 
-	// Write preamble explaining the structure
-	sb.WriteString(`This is a structured prompt for a software development task.
+			if len(matching) > 0 {
+				backupContext(m.context)
+				m.context.RemoveFiles(matching)
+				if err := SaveContext(m.context); err != nil {
+					return m.setError("Error saving", err)
+				}
+				m.refreshFiles()
+				if m.cursor >= len(m.files) {
+					m.cursor = max(len(m.files)-1, 0)
+				}
+				if m.offset > m.cursor {
+					m.offset = m.cursor
+				}
+				if m.folderCursor >= len(m.folders) {
+					m.folderCursor = max(len(m.folders)-1, 0)
+				}
+				if m.folderOffset > m.folderCursor {
+					m.folderOffset = m.folderCursor
+				}
+			}
 
-<project_context> describes the project: its purpose, tech stack, architecture, and coding conventions. Use this to understand the broader context.
+			// Nothing left to show in folder view
+			if m.mode == modeFolderView && len(m.folders) == 0 {
+				m.mode = modeNormal
+			}
 
-<request> contains the specific task or question to address. This is what you should focus on accomplishing.
+			return m.setStatus(fmt.Sprintf("Excluded %s, removed %d files", pattern, len(matching)))
+		},
+	})
+}
 
-<file> tags contain the relevant source files. Each file has a path attribute. Use these to understand the current implementation and make appropriate changes.
+// compactAllContexts asks, then removes missing and duplicate files from every saved
+// context and shows a per-context summary
+func (m *Model) compactAllContexts() tea.Cmd {
+	m.askConfirm(confirmPrompt{
+		title:      "Compact All Contexts",
+		lines:      []string{"Remove missing files and repeated paths from every saved context?"},
+		warning:    "Each changed context is backed up first.",
+		cancelMode: modeNormal,
+		onConfirm: func(m *Model) tea.Cmd {
+			summaries, err := CompactAllContexts()
+			if err != nil {
+				return m.setError("Error", err)
+			}
 
----
+			// The active context may have changed on disk
+			if m.context.SourcePath == "" {
+				if ctx, err := LoadContext(m.context.Name); err == nil {
+					m.context = ctx
+					m.refreshFiles()
+					m.cursor = min(m.cursor, max(len(m.files)-1, 0))
+					m.offset = min(m.offset, m.cursor)
+				}
+			}
 
-`)
+			m.auditTitle = "Compact All Contexts"
+			m.auditLines = []string{"Compacted contexts"}
+			for _, s := range summaries {
+				m.auditLines = append(m.auditLines, "  "+s.String())
+			}
+			m.auditOffset = 0
+			m.mode = modeAudit
+			return nil
+		},
+	})
+	return nil
+}
 
-	// Write project context
-	if entry.ProjectContext != "" {
-		sb.WriteString("<project_context>\n")
-		sb.WriteString(entry.ProjectContext)
-		if !strings.HasSuffix(entry.ProjectContext, "\n") {
-			sb.WriteString("\n")
+// removeDuplicates asks before dropping files whose content is identical to an
+// earlier file in the context, keeping the first of each group
+func (m *Model) removeDuplicates() tea.Cmd {
+	groups := findContentDuplicates(m.files)
+	if len(groups) == 0 {
+		return m.setStatus("No duplicate files")
+	}
+
+	// Keep the file that comes first in the stored order
+	order := make(map[string]int, len(m.context.Files))
+	for i, f := range m.context.Files {
+		order[f] = i
+	}
+	var sorted [][]string
+	for _, paths := range groups {
+		sort.Slice(paths, func(i, j int) bool { return order[paths[i]] < order[paths[j]] })
+		sorted = append(sorted, paths)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return order[sorted[i][0]] < order[sorted[j][0]] })
+
+	var drop []string
+	lines := []string{fmt.Sprintf("%d group(s) of identical files:", len(sorted)), ""}
+	for _, paths := range sorted {
+		lines = append(lines, "  keep "+displayPath(paths[0], m.projectRoot()))
+		for _, p := range paths[1:] {
+			lines = append(lines, "  drop "+displayPath(p, m.projectRoot()))
+			drop = append(drop, p)
 		}
-		sb.WriteString("</project_context>\n\n")
 	}
+	lines = append(lines, "", fmt.Sprintf("Remove %d duplicate file(s)?", len(drop)))
+
+	m.askConfirm(confirmPrompt{
+		title:      "Remove Duplicates",
+		lines:      lines,
+		cancelMode: modeNormal,
+		onConfirm: func(m *Model) tea.Cmd {
+			backupContext(m.context)
+			m.context.RemoveFiles(drop)
+			if err := SaveContext(m.context); err != nil {
+				return m.setError("Error saving", err)
+			}
+			m.refreshFiles()
+			if m.cursor >= len(m.files) {
+				m.cursor = max(len(m.files)-1, 0)
+			}
+			if m.offset > m.cursor {
+				m.offset = m.cursor
+			}
+			return m.setStatus(fmt.Sprintf("Removed %d duplicate files", len(drop)))
+		},
+	})
+	return nil
+}
 
-	// Write request
-	if entry.Request != "" {
-		sb.WriteString("<request>\n")
-		sb.WriteString(entry.Request)
-		if !strings.HasSuffix(entry.Request, "\n") {
-			sb.WriteString("\n")
-		}
-		sb.WriteString("</request>\n\n")
+// yankCursorFile copies only the file under the cursor, wrapped in its <file> tag
+func (m *Model) yankCursorFile() tea.Cmd {
+	if m.cursor >= len(m.files) {
+		return m.setStatus("No file selected")
 	}
+	f := m.files[m.cursor]
 
-	// Write files (read from disk)
-	for _, filePath := range entry.Files {
-		content, err := os.ReadFile(filePath)
-		if err != nil {
-			continue // Skip files that can't be read
-		}
+	text, err := buildFilePrompt(m.config, f.Path, m.projectRoot(), m.context.Notes[f.Path])
+	if err != nil {
+		return m.setError("Error", err)
+	}
 
-		sb.WriteString(fmt.Sprintf("<file path=\"%s\">\n", filePath))
-		sb.Write(content)
-		if len(content) > 0 && content[len(content)-1] != '\n' {
-			sb.WriteString("\n")
-		}
-		sb.WriteString("</file>\n\n")
+	if err := CopyToClipboard(text, m.config.VerifyClipboard); err != nil {
+		return m.setClipboardError(err)
+	}
+	return m.setStatus("Yanked " + displayPath(f.Path, m.projectRoot()))
+}
+
+func (m *Model) copyCursorPath() tea.Cmd {
+	if m.cursor >= len(m.files) {
+		return m.setStatus("No file selected")
 	}
 
-	// Copy to clipboard
-	if err := CopyToClipboard(sb.String()); err != nil {
-		return m.setStatus(fmt.Sprintf("Clipboard error: %v", err))
+	path := m.files[m.cursor].Path
+	if err := CopyToClipboard(path, m.config.VerifyClipboard); err != nil {
+		return m.setClipboardError(err)
 	}
 
-	return m.setStatus(fmt.Sprintf("Yanked history entry (%d files)", len(entry.Files)))
+	return m.setStatus(fmt.Sprintf("Copied path: %s", path))
 }
 
-func (m *Model) deleteSelected() tea.Cmd {
-	selected := m.selectedCount()
-
-	if selected > 0 {
-		// Delete all selected
-		var toRemove []string
-		for _, f := range m.files {
-			if f.Selected {
-				toRemove = append(toRemove, f.Path)
-			}
+func (m *Model) removeMissing() tea.Cmd {
+	var missing []string
+	for _, f := range m.files {
+		if !f.Exists {
+			missing = append(missing, f.Path)
 		}
-		m.context.RemoveFiles(toRemove)
-	} else if m.cursor < len(m.files) {
-		// Delete cursor item
-		m.context.RemoveFile(m.files[m.cursor].Path)
 	}
 
+	if len(missing) == 0 {
+		return m.setStatus("No missing files")
+	}
+
+	backupContext(m.context)
+	m.context.RemoveFiles(missing)
 	if err := SaveContext(m.context); err != nil {
-		return m.setStatus(fmt.Sprintf("Error saving: %v", err))
+		return m.setError("Error saving", err)
 	}
 
 	m.refreshFiles()
 
 	// Adjust cursor if needed
-	if m.cursor >= len(m.files) && m.cursor > 0 {
-		m.cursor = len(m.files) - 1
+	if m.cursor >= len(m.files) {
+		m.cursor = max(len(m.files)-1, 0)
 	}
-
-	if selected > 0 {
-		return m.setStatus(fmt.Sprintf("Deleted %d files", selected))
+	if m.offset > m.cursor {
+		m.offset = m.cursor
 	}
-	return m.setStatus("Deleted file")
+
+	return m.setStatus(fmt.Sprintf("Removed %d missing files", len(missing)))
 }
 
 func (m Model) enterContextSelect() (tea.Model, tea.Cmd) {
 	contexts, err := ListContexts()
 	if err != nil {
-		return m, m.setStatus(fmt.Sprintf("Error: %v", err))
+		return m, m.setError("Error", err)
 	}
 
-	m.selectItems = append([]string{"[+] New context"}, contexts...)
+	m.selectItems = append([]string{newContextItem}, contexts...)
 	m.selectCursor = 0
+	m.selectFilter = ""
+	m.selectBroken = UnloadableContexts()
+	m.selectMarked = make(map[string]bool)
 
 	// Position cursor on current context
 	for i, name := range m.selectItems {
@@ -1126,14 +3490,106 @@ func (m Model) enterContextSelect() (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// mergeContext appends another context's files (and optionally text) to the active context
+func (m *Model) mergeContext(name string, includeText bool) tea.Cmd {
+	from, err := LoadContext(name)
+	if err != nil {
+		return m.setError("Error", err)
+	}
+
+	added := MergeContext(&m.context, from, includeText)
+	if err := SaveContext(m.context); err != nil {
+		return m.setError("Error saving", err)
+	}
+	m.refreshFiles()
+
+	return m.setStatus(fmt.Sprintf("Merged %s: added %d files", name, added))
+}
+
+func (m Model) enterContextSizes() (tea.Model, tea.Cmd) {
+	sizes, err := ListContextSizes()
+	if err != nil {
+		return m, m.setError("Error", err)
+	}
+	m.contextSizes = sizes
+	m.selectCursor = 0
+	m.mode = modeContextSizes
+	return m, nil
+}
+
+func (m Model) handleContextSizesKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "q", "L":
+		// Back to the context picker
+		return m.enterContextSelect()
+
+	case "up", "k":
+		if m.selectCursor > 0 {
+			m.selectCursor--
+		}
+
+	case "down", "j":
+		if m.selectCursor < len(m.contextSizes)-1 {
+			m.selectCursor++
+		}
+
+	case "enter":
+		m.mode = modeNormal
+		if m.selectCursor < len(m.contextSizes) {
+			return m, m.switchToContext(m.contextSizes[m.selectCursor].Name)
+		}
+	}
+
+	return m, nil
+}
+
+func (m Model) enterBackupSelect() (tea.Model, tea.Cmd) {
+	backups, err := ListBackups()
+	if err != nil {
+		return m, m.setError("Error", err)
+	}
+	if len(backups) == 0 {
+		return m, m.setStatus("No backups")
+	}
+
+	m.selectItems = backups
+	m.selectCursor = 0
+	m.selectFilter = ""
+	m.mode = modeBackupSelect
+	return m, nil
+}
+
+// restoreBackup saves a backed-up context under its name (backing up the current
+// version first, if any) and switches to it
+func (m *Model) restoreBackup(name string) tea.Cmd {
+	ctx, err := LoadBackup(name)
+	if err != nil {
+		return m.setError("Error", err)
+	}
+
+	if current, err := LoadContext(ctx.Name); err == nil {
+		backupContext(current)
+	}
+	if err := SaveContext(ctx); err != nil {
+		return m.setError("Error saving", err)
+	}
+
+	m.contexts, _ = ListContexts()
+	if cmd := m.switchToContext(ctx.Name); cmd != nil {
+		return cmd
+	}
+	return m.setStatus(fmt.Sprintf("Restored %s (%d files)", ctx.Name, len(ctx.Files)))
+}
+
 func (m Model) enterExcludeSelect() (tea.Model, tea.Cmd) {
 	excludes, err := ListExcludeRules()
 	if err != nil {
-		return m, m.setStatus(fmt.Sprintf("Error: %v", err))
+		return m, m.setError("Error", err)
 	}
 
 	m.selectItems = excludes
 	m.selectCursor = 0
+	m.selectFilter = ""
 
 	// Position cursor on current exclude
 	for i, name := range m.selectItems {
@@ -1150,21 +3606,25 @@ func (m Model) enterExcludeSelect() (tea.Model, tea.Cmd) {
 func (m Model) reload() (tea.Model, tea.Cmd) {
 	cfg, err := LoadConfig()
 	if err != nil {
-		return m, m.setStatus(fmt.Sprintf("Error: %v", err))
+		return m, m.setError("Error", err)
 	}
 	m.config = cfg
 
-	ctx, err := LoadContext(cfg.ActiveContext)
+	// A context opened with --context-file is reloaded from its file
+	var ctx Context
+	if m.context.SourcePath != "" {
+		ctx, err = LoadContextFromPath(m.context.SourcePath)
+	} else {
+		ctx, err = LoadContext(cfg.ActiveContext)
+	}
 	if err != nil {
-		return m, m.setStatus(fmt.Sprintf("Error: %v", err))
+		return m, m.setError("Error", err)
 	}
 	m.context = ctx
 
-	exc, err := LoadExcludeRule(cfg.ActiveExclude)
-	if err != nil {
-		return m, m.setStatus(fmt.Sprintf("Error: %v", err))
+	if err := m.refreshExclude(); err != nil {
+		return m, m.setError("Error", err)
 	}
-	m.exclude = exc
 
 	// Refresh contexts list
 	contexts, err := ListContexts()
@@ -1172,12 +3632,42 @@ func (m Model) reload() (tea.Model, tea.Cmd) {
 		m.contexts = contexts
 	}
 
+	m.cache.Clear()
 	m.refreshFiles()
 	m.cursor = 0
 
 	return m, m.setStatus("Reloaded")
 }
 
+// reloadCursorFile re-stats and re-reads the cursor file only, keeping the list
+// order, scroll position and selection
+func (m *Model) reloadCursorFile() tea.Cmd {
+	if m.cursor >= len(m.files) {
+		return nil
+	}
+
+	old := m.files[m.cursor]
+	m.cache.ForgetLines(old.Path) // recount even if size and mtime look unchanged
+	info := m.buildFileInfo(old.Path)
+	info.Selected = old.Selected
+	m.files[m.cursor] = info
+	// Totals and yanks read allFiles, which files doesn't alias in missing-only mode
+	if i := slices.IndexFunc(m.allFiles, func(f FileInfo) bool { return f.Path == info.Path }); i >= 0 {
+		m.allFiles[i] = info
+	}
+	m.refreshFolders()
+
+	name := displayPath(info.Path, m.projectRoot())
+	if !info.Exists {
+		m.cache.Reload(info.Path) // drops the stale entry
+		return m.setStatus("Missing: " + name)
+	}
+	if err := m.cache.Reload(info.Path); err != nil {
+		return m.setError(fmt.Sprintf("Error reading %s", name), err)
+	}
+	return m.setStatus(fmt.Sprintf("Reloaded %s (%s)", name, formatSize(info.Size)))
+}
+
 // Styles
 var (
 	titleStyle = lipgloss.NewStyle().
@@ -1209,6 +3699,28 @@ func (m Model) View() string {
 		return m.viewSelect("Select Context")
 	case modeExcludeSelect:
 		return m.viewSelect("Select Exclude Rule")
+	case modeBackupSelect:
+		return m.viewSelect("Restore Backup")
+	case modeTemplateSelect:
+		return m.viewSelect(fmt.Sprintf("Start '%s' From Template", m.newContextName))
+	case modeExcludeTest:
+		return m.viewInput(fmt.Sprintf("Test Exclude Rule '%s' on Directory", m.exclude.Name), m.inputBuffer)
+	case modeExcludeTestResult:
+		return m.viewExcludeTest()
+	case modeEditPath:
+		return m.viewInput("Edit File Path", m.inputBuffer)
+	case modeContextFromFile:
+		return m.viewInput("Project Context From File (path or path#Section)", m.inputBuffer)
+	case modeProjectRoot:
+		return m.viewInput("Project Root (empty to clear)", m.inputBuffer)
+	case modeContextSizes:
+		return m.viewContextSizes()
+	case modeAddDirList:
+		return m.viewInput("Add Directories Listed in File", m.inputBuffer)
+	case modeExportHistory:
+		return m.viewInput("Export History To (.json for JSON, else YAML; empty copies YAML to clipboard)", m.inputBuffer)
+	case modeEditNote:
+		return m.viewInput("Note for "+displayPath(m.editPathOrig, m.projectRoot())+" (empty to remove)", m.inputBuffer)
 	case modeNewContext:
 		return m.viewInput("New Context Name", m.inputBuffer)
 	case modeAddFile:
@@ -1217,27 +3729,148 @@ func (m Model) View() string {
 		return m.viewConfig()
 	case modeEditBox:
 		return m.viewEditBox()
-	case modeConfirmDeleteCtx:
-		return m.viewConfirmDelete()
+	case modeConfirm:
+		return m.viewConfirm()
+	case modeHistoryDiff:
+		return m.viewHistoryDiff()
+	case modeFullPreview:
+		return m.viewFullPreview()
+	case modeAudit:
+		return m.viewAudit()
+	case modeSkipPrefixes:
+		return m.viewSkipPrefixes()
+	case modeCommand:
+		return m.viewCommandPalette()
+	case modeHelp:
+		return m.viewHelp()
+	case modeStats:
+		return m.viewStats()
 	}
 
 	// Normal mode - split view (context or history tab)
 	return m.viewSplit()
 }
 
-func (m Model) viewConfirmDelete() string {
+func (m Model) viewConfirm() string {
 	var sb strings.Builder
 
-	sb.WriteString(errorStyle.Render("Delete Context"))
+	sb.WriteString(errorStyle.Render(m.confirm.title))
 	sb.WriteString("\n")
 	sb.WriteString(strings.Repeat("─", min(m.width, 40)))
 	sb.WriteString("\n\n")
-	sb.WriteString(fmt.Sprintf("Are you sure you want to delete '%s'?\n\n", m.deleteTarget))
-	sb.WriteString(warningStyle.Render("This action cannot be undone."))
-	sb.WriteString("\n\n")
+	for _, line := range m.confirm.lines {
+		sb.WriteString(line)
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n")
+	if m.confirm.warning != "" {
+		sb.WriteString(warningStyle.Render(m.confirm.warning))
+		sb.WriteString("\n\n")
+	}
 	sb.WriteString(strings.Repeat("─", min(m.width, 40)))
 	sb.WriteString("\n")
-	sb.WriteString(dimStyle.Render("[y]es  [n]o"))
+	if m.confirm.onDeny != nil {
+		sb.WriteString(dimStyle.Render("[y]es  [n]o  [esc] cancel"))
+	} else {
+		sb.WriteString(dimStyle.Render("[y]es  [n]o"))
+	}
+	sb.WriteString("\n")
+
+	return sb.String()
+}
+
+func (m Model) viewHistoryDiff() string {
+	var sb strings.Builder
+
+	addStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("10"))
+
+	sb.WriteString(titleStyle.Render("History Diff"))
+	sb.WriteString("\n")
+	sb.WriteString(strings.Repeat("─", min(m.width, 60)))
+	sb.WriteString("\n")
+
+	visibleRows := m.visibleFileRows()
+	endIdx := min(m.diffOffset+visibleRows, len(m.diffLines))
+	for _, line := range m.diffLines[m.diffOffset:endIdx] {
+		if len(line) > m.width {
+			line = truncateWidth(line, m.width)
+		}
+		switch {
+		case strings.HasPrefix(line, "+"):
+			line = addStyle.Render(line)
+		case strings.HasPrefix(line, "-"):
+			line = errorStyle.Render(line)
+		}
+		sb.WriteString(line)
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString(strings.Repeat("─", min(m.width, 60)))
+	sb.WriteString("\n")
+	sb.WriteString(dimStyle.Render(fmt.Sprintf("[↑/↓]scroll  [esc] back  (%d/%d)", endIdx, len(m.diffLines))))
+	sb.WriteString("\n")
+
+	return sb.String()
+}
+
+func (m Model) viewAudit() string {
+	var sb strings.Builder
+
+	sb.WriteString(titleStyle.Render(m.auditTitle))
+	sb.WriteString("\n")
+	sb.WriteString(strings.Repeat("─", min(m.width, 60)))
+	sb.WriteString("\n")
+
+	visibleRows := m.visibleFileRows()
+	endIdx := min(m.auditOffset+visibleRows, len(m.auditLines))
+	for _, line := range m.auditLines[m.auditOffset:endIdx] {
+		if len(line) > m.width {
+			line = truncateWidth(line, m.width)
+		}
+		switch {
+		case !strings.HasPrefix(line, " ") && line != "":
+			line = titleStyle.Render(line)
+		case strings.HasPrefix(line, "    "):
+			line = dimStyle.Render(line)
+		}
+		sb.WriteString(line)
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString(strings.Repeat("─", min(m.width, 60)))
+	sb.WriteString("\n")
+	sb.WriteString(dimStyle.Render(fmt.Sprintf("[↑/↓]scroll  [esc] back  (%d/%d)", endIdx, len(m.auditLines))))
+	sb.WriteString("\n")
+
+	return sb.String()
+}
+
+func (m Model) viewFullPreview() string {
+	var sb strings.Builder
+
+	sb.WriteString(titleStyle.Render("Full Preview"))
+	sb.WriteString("\n")
+	sb.WriteString(strings.Repeat("─", min(m.width, 60)))
+	sb.WriteString("\n")
+
+	// Only visible lines are highlighted, so large contexts stay cheap to scroll
+	visibleRows := m.visibleFileRows()
+	endIdx := min(m.pagerOffset+visibleRows, len(m.pagerLines))
+	for i := m.pagerOffset; i < endIdx; i++ {
+		line := strings.ReplaceAll(m.pagerLines[i], "\t", "    ")
+		if len(line) > m.width {
+			line = truncateWidth(line, m.width)
+		}
+		if m.config.SyntaxHighlight && m.pagerLangs[i] != "" {
+			line = highlightLine(line, m.pagerLangs[i])
+		}
+		sb.WriteString(line)
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString(strings.Repeat("─", min(m.width, 60)))
+	sb.WriteString("\n")
+	sb.WriteString(dimStyle.Render(fmt.Sprintf("[↑/↓]scroll  [pgup/pgdn]page  [g/G]top/bottom  [esc] back  (%d/%d)", endIdx, len(m.pagerLines))))
 	sb.WriteString("\n")
 
 	return sb.String()
@@ -1292,7 +3925,16 @@ func (m Model) viewSplit() string {
 				output.WriteString(dimStyle.Render("(" + name + ")") + " ")
 			}
 		}
-		output.WriteString(dimStyle.Render(fmt.Sprintf("Total: %s (%d files)", formatSize(m.totalSize()), len(m.files))))
+		output.WriteString(dimStyle.Render(fmt.Sprintf("Total: %s (%d files, %d lines)", formatSize(m.totalSize()), len(m.allFiles), m.totalLines())))
+		if m.missingOnly {
+			output.WriteString("  " + warningStyle.Render(fmt.Sprintf("! %d missing shown", len(m.files))))
+		}
+		if root := m.projectRoot(); root != "" {
+			output.WriteString("  " + dimStyle.Render("Root: "+m.showPath(root)))
+		}
+		if changed := m.changedCount(); changed > 0 {
+			output.WriteString("  " + warningStyle.Render(fmt.Sprintf("* %d changed since yank", changed)))
+		}
 		if m.totalSize() > 600*1024 {
 			output.WriteString("  " + errorStyle.Render("⚠ May exceed limits"))
 		} else if m.totalSize() > 400*1024 {
@@ -1323,7 +3965,6 @@ func (m Model) viewContextTab() string {
 		halfWidth = 30
 	}
 	leftWidth := halfWidth - 4  // account for borders
-	rightWidth := halfWidth - 4
 
 	// Box heights: total height - 2 (header + keys), divide by 3 for left boxes
 	// Each box needs 2 lines for border, so content height = boxHeight - 2
@@ -1344,8 +3985,8 @@ func (m Model) viewContextTab() string {
 	projectBox := m.createBorderedBox("Project Context", m.context.ProjectContext, leftWidth, contentHeight, m.activeBox == boxProjectContext)
 
 	// Create bordered preview box (spans full height)
-	previewContentHeight := totalBoxArea - 2 // borders
-	previewBox := m.createBorderedPreviewBox(rightWidth, previewContentHeight)
+	previewWidth, previewContentHeight := m.previewSize()
+	previewBox := m.createBorderedPreviewBox(previewWidth, previewContentHeight)
 
 	// Split boxes into lines
 	reqLines := strings.Split(requestBox, "\n")
@@ -1376,8 +4017,8 @@ func (m Model) viewContextTab() string {
 		output.WriteString("\n")
 	}
 
-	// Keybindings
-	output.WriteString(dimStyle.Render("[y]ank [d]el [a]dd [f]olders [e]dit [r]eload [c]tx [{/}]switch [tab]box [q]uit"))
+	// Keybindings (or status)
+	output.WriteString(m.statusLine("[y]ank [d]el [a]dd [f]olders [e]dit [r]eload [c]tx [{/}]switch [tab]box [:]cmd [?]help [q]uit"))
 
 	return output.String()
 }
@@ -1427,12 +4068,23 @@ func (m Model) viewHistoryTab() string {
 		output.WriteString("\n")
 	}
 
-	// Keybindings for history tab
-	output.WriteString(dimStyle.Render("[y]ank  [↑/↓]navigate  [q]uit"))
+	// Keybindings for history tab (or status)
+	output.WriteString(m.statusLine("[y]ank  [P]in  [space]base  [=]diff  [↑/↓]navigate  [?]help  [q]uit"))
 
 	return output.String()
 }
 
+// statusLine renders the bottom line: yank progress, the status message, or the keybinding hints
+func (m Model) statusLine(hints string) string {
+	if m.yanking {
+		return m.spinner.View() + " " + warningStyle.Render(fmt.Sprintf("Reading %d/%d", m.yankDone, m.yankTotal))
+	}
+	if m.status != "" {
+		return selectedStyle.Render(m.status)
+	}
+	return dimStyle.Render(hints)
+}
+
 func (m Model) createBorderedHistoryBox(width int, height int) string {
 	bc := lipgloss.Color("14") // cyan for active
 
@@ -1456,6 +4108,14 @@ func (m Model) createBorderedHistoryBox(width int, height int) string {
 			lines = append(lines, dimStyle.Render(fmt.Sprintf("↑ %d more above", m.historyOffset)))
 		}
 
+		// Pad timestamps to the widest visible one (relative times vary in length)
+		timestamps := make([]string, endIdx-m.historyOffset)
+		tsWidth := 0
+		for i := range timestamps {
+			timestamps[i] = m.historyEntries[m.historyOffset+i].FormatTimestamp(m.config)
+			tsWidth = max(tsWidth, len(timestamps[i]))
+		}
+
 		for i := m.historyOffset; i < endIdx; i++ {
 			entry := m.historyEntries[i]
 			prefix := "  "
@@ -1463,10 +4123,14 @@ func (m Model) createBorderedHistoryBox(width int, height int) string {
 				prefix = "> "
 			}
 
-			// Format: timestamp | context
-			timestamp := entry.FormatTimestamp()
+			// Format: timestamp | size | context
+			timestamp := fmt.Sprintf("%-*s", tsWidth, timestamps[i-m.historyOffset])
+			size := ""
+			if entry.TotalBytes > 0 {
+				size = formatSize(entry.TotalBytes)
+			}
 			contextName := entry.ContextName
-			maxCtxLen := width - 20
+			maxCtxLen := width - tsWidth - 13
 			if maxCtxLen < 8 {
 				maxCtxLen = 8
 			}
@@ -1474,10 +4138,17 @@ func (m Model) createBorderedHistoryBox(width int, height int) string {
 				contextName = contextName[:maxCtxLen-3] + "..."
 			}
 
-			line := fmt.Sprintf("%s%s  %s", prefix, timestamp, contextName)
+			pin := " "
+			if entry.Pinned {
+				pin = "*"
+			}
+
+			line := fmt.Sprintf("%s%s%s %6s  %s", prefix, pin, timestamp, size, contextName)
 
 			if i == m.historyCursor {
 				line = cursorStyle.Render(line)
+			} else if i == m.historyBase {
+				line = selectedStyle.Render(line)
 			}
 
 			lines = append(lines, line)
@@ -1499,7 +4170,7 @@ func (m Model) createBorderedHistoryBox(width int, height int) string {
 
 	// Build box
 	var box strings.Builder
-	title := fmt.Sprintf("History (%d)", len(m.historyEntries))
+	title := fmt.Sprintf("History (%d, %s)", len(m.historyEntries), m.historyOrderName())
 	activeTitleStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("14")).Bold(true)
 	titleStr := activeTitleStyle.Render("▸ " + title)
 	titleLen := len(title) + 2
@@ -1533,6 +4204,12 @@ func (m Model) createBorderedHistoryPreviewBox(width int, height int) string {
 	if len(m.historyEntries) > 0 && m.historyCursor < len(m.historyEntries) {
 		entry := m.historyEntries[m.historyCursor]
 
+		// Size stats (only recorded for newer entries)
+		if summary := entry.SizeSummary(); summary != "" {
+			lines = append(lines, dimStyle.Render(summary))
+			lines = append(lines, "")
+		}
+
 		// Project context (truncated)
 		if entry.ProjectContext != "" {
 			lines = append(lines, dimStyle.Render("<project_context>"))
@@ -1542,10 +4219,9 @@ func (m Model) createBorderedHistoryPreviewBox(width int, height int) string {
 					lines = append(lines, dimStyle.Render("  ...truncated"))
 					break
 				}
-				if len(line) > width-4 {
-					line = line[:width-7] + "..."
+				for _, l := range fitLine(line, width-4, m.config.WrapText) {
+					lines = append(lines, "  "+l)
 				}
-				lines = append(lines, "  "+line)
 			}
 			lines = append(lines, dimStyle.Render("</project_context>"))
 			lines = append(lines, "")
@@ -1561,10 +4237,9 @@ func (m Model) createBorderedHistoryPreviewBox(width int, height int) string {
 					lines = append(lines, dimStyle.Render("  ...truncated"))
 					break
 				}
-				if len(line) > width-4 {
-					line = line[:width-7] + "..."
+				for _, l := range fitLine(line, width-4, m.config.WrapText) {
+					lines = append(lines, "  "+l)
 				}
-				lines = append(lines, "  "+line)
 			}
 			lines = append(lines, dimStyle.Render("</request>"))
 			lines = append(lines, "")
@@ -1578,13 +4253,30 @@ func (m Model) createBorderedHistoryPreviewBox(width int, height int) string {
 				lines = append(lines, dimStyle.Render(fmt.Sprintf("  ... +%d more files", len(entry.Files)-maxFiles)))
 				break
 			}
-			path := f
+			path := m.showPath(f)
 			if len(path) > width-6 {
 				path = "..." + path[len(path)-width+9:]
 			}
 			lines = append(lines, "  "+path)
 		}
 		lines = append(lines, dimStyle.Render("</files>"))
+
+		// Files that were in the context but disabled
+		if len(entry.DisabledFiles) > 0 {
+			lines = append(lines, "")
+			lines = append(lines, dimStyle.Render(fmt.Sprintf("Disabled (%d, not in the prompt):", len(entry.DisabledFiles))))
+			for i, f := range entry.DisabledFiles {
+				if i >= maxFiles {
+					lines = append(lines, dimStyle.Render(fmt.Sprintf("  ... +%d more files", len(entry.DisabledFiles)-maxFiles)))
+					break
+				}
+				path := m.showPath(f)
+				if len(path) > width-6 {
+					path = "..." + path[len(path)-width+9:]
+				}
+				lines = append(lines, dimStyle.Render("  # "+path))
+			}
+		}
 	} else {
 		lines = append(lines, dimStyle.Render("(select an entry)"))
 	}
@@ -1619,6 +4311,12 @@ func (m Model) createBorderedHistoryPreviewBox(width int, height int) string {
 }
 
 func (m Model) createBorderedBox(title string, content string, width int, height int, active bool) string {
+	// Text boxes only change when their content, size or focus does
+	key := boxKey{title: title, content: content, width: width, height: height, active: active, wrap: m.config.WrapText}
+	if box, ok := m.boxes.get(key); ok {
+		return box
+	}
+
 	borderColor := "240"
 	if active {
 		borderColor = "14" // bright cyan for active
@@ -1632,12 +4330,12 @@ func (m Model) createBorderedBox(title string, content string, width int, height
 		lines = strings.Split(content, "\n")
 	}
 
-	// Truncate/pad to fit
-	for i := range lines {
-		if len(lines[i]) > width-2 {
-			lines[i] = lines[i][:width-5] + "..."
-		}
+	// Wrap or truncate, then pad to fit
+	var fitted []string
+	for _, line := range lines {
+		fitted = append(fitted, fitLine(line, width-2, m.config.WrapText)...)
 	}
+	lines = fitted
 	for len(lines) < height {
 		lines = append(lines, "")
 	}
@@ -1675,6 +4373,7 @@ func (m Model) createBorderedBox(title string, content string, width int, height
 	// Bottom border
 	box.WriteString(lipgloss.NewStyle().Foreground(bc).Render("╰" + strings.Repeat("─", width+2) + "╯"))
 
+	m.boxes.put(key, box.String())
 	return box.String()
 }
 
@@ -1687,48 +4386,93 @@ func (m Model) createBorderedFilesBox(width int, height int, active bool) string
 	// Prepare content
 	var lines []string
 	sizeStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("6")) // cyan for size
+	tagStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("5"))  // magenta for type tag
 	sizeWidth := 8 // fixed width for size column
 
 	if len(m.files) == 0 {
 		lines = []string{dimStyle.Render("(no files)")}
 	} else {
-		for i, f := range m.files {
-			if i >= height {
-				lines = append(lines, dimStyle.Render(fmt.Sprintf("... +%d more", len(m.files)-height)))
+		// Scroll so the cursor stays visible in this box
+		start := min(m.offset, m.cursor)
+		if m.cursor >= start+height {
+			start = m.cursor - height + 1
+		}
+		for i := start; i < len(m.files); i++ {
+			f := m.files[i]
+			if i >= start+height {
+				lines = append(lines, dimStyle.Render(fmt.Sprintf("... +%d more", len(m.files)-i)))
 				break
 			}
 			prefix := "  "
 			if i == m.cursor {
 				prefix = "> "
 			}
+			if f.Changed {
+				prefix = prefix[:1] + "*"
+			}
 
-			// Calculate available width for path (total - prefix - size - spacing)
-			pathWidth := width - len(prefix) - sizeWidth - 1
+			// Type tag column (icons are one cell wide)
+			tag := fileTag(f.Path, m.config.FileIcons)
+			tagPad := fileTagWidth - lipgloss.Width(tag)
+			paddedTag := tagStyle.Render(tag) + strings.Repeat(" ", max(tagPad, 0)) + " "
+
+			// Calculate available width for path (total - prefix - tag - size - spacing)
+			pathWidth := width - len(prefix) - fileTagWidth - 1 - sizeWidth - 1
 			if pathWidth < 10 {
 				pathWidth = 10
 			}
 
+			// Symlinks get a (symlink→<target size>) tag after the path, if it fits
+			linkTag := ""
+			if f.Symlink {
+				linkTag = " (symlink→" + formatSize(f.Size) + ")"
+			}
+			room := pathWidth - lipgloss.Width(linkTag)
+			if room < 10 {
+				linkTag = ""
+				room = pathWidth
+			}
+
+			// Pinned files get a flag glyph before the path, disabled ones a #
+			pinGlyph := ""
+			if f.Pinned {
+				pinGlyph = "⚑ "
+				room -= 2
+			}
+			if f.Disabled {
+				pinGlyph += "# "
+				room -= 2
+			}
+
 			path := f.RelPath
-			if len(path) > pathWidth {
-				path = "..." + path[len(path)-pathWidth+3:]
+			if len(path) > room {
+				path = "..." + path[len(path)-room+3:]
 			}
+			path = pinGlyph + path + linkTag
 
 			// Pad path to fixed width for table alignment
-			paddedPath := path + strings.Repeat(" ", pathWidth-len(path))
+			paddedPath := path + strings.Repeat(" ", max(pathWidth-lipgloss.Width(path), 0))
 
-			// Format size right-aligned
+			// Format size right-aligned (oversized symlink targets in red)
 			size := formatSize(f.Size)
 			paddedSize := fmt.Sprintf("%*s", sizeWidth, size)
+			sizeStyle := sizeStyle
+			if f.Oversize {
+				sizeStyle = errorStyle
+			}
 
 			// Build line with colored size
 			if i == m.cursor {
-				line := cursorStyle.Render(prefix + paddedPath) + " " + sizeStyle.Render(paddedSize)
+				line := cursorStyle.Render(prefix) + paddedTag + cursorStyle.Render(paddedPath) + " " + sizeStyle.Render(paddedSize)
 				lines = append(lines, line)
 			} else if f.Selected {
-				line := selectedStyle.Render(prefix + paddedPath) + " " + sizeStyle.Render(paddedSize)
+				line := selectedStyle.Render(prefix) + paddedTag + selectedStyle.Render(paddedPath) + " " + sizeStyle.Render(paddedSize)
+				lines = append(lines, line)
+			} else if f.Disabled {
+				line := prefix + paddedTag + dimStyle.Render(paddedPath) + " " + dimStyle.Render(paddedSize)
 				lines = append(lines, line)
 			} else {
-				line := prefix + paddedPath + " " + sizeStyle.Render(paddedSize)
+				line := prefix + paddedTag + paddedPath + " " + sizeStyle.Render(paddedSize)
 				lines = append(lines, line)
 			}
 		}
@@ -1746,6 +4490,12 @@ func (m Model) createBorderedFilesBox(width int, height int, active bool) string
 	var box strings.Builder
 	bc := lipgloss.Color(borderColor)
 	title := fmt.Sprintf("Files (%d)", len(m.files))
+	if m.config.SortMode == sortName || m.config.SortMode == sortCustom {
+		title = fmt.Sprintf("Files (%d, %s order)", len(m.files), m.config.SortMode)
+	}
+	if m.missingOnly {
+		title = fmt.Sprintf("Files (%d missing of %d)", len(m.files), len(m.allFiles))
+	}
 
 	activeTitleStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("14")).Bold(true)
 	titleStr := title
@@ -1781,7 +4531,46 @@ func (m Model) createBorderedFilesBox(width int, height int, active bool) string
 func (m Model) createBorderedPreviewBox(width int, height int) string {
 	bc := lipgloss.Color("240")
 
-	// Build preview content
+	lines := m.previewLines(width, height)
+
+	// Pad to height
+	for len(lines) < height {
+		lines = append(lines, "")
+	}
+
+	// Build box
+	var box strings.Builder
+	title := "Preview"
+
+	box.WriteString(lipgloss.NewStyle().Foreground(bc).Render("╭─"))
+	box.WriteString(dimStyle.Render(title))
+	box.WriteString(lipgloss.NewStyle().Foreground(bc).Render(strings.Repeat("─", width-len(title)+1) + "╮"))
+	box.WriteString("\n")
+
+	for _, line := range lines {
+		box.WriteString(lipgloss.NewStyle().Foreground(bc).Render("│ "))
+		box.WriteString(padRight(line, width))
+		box.WriteString(lipgloss.NewStyle().Foreground(bc).Render(" │"))
+		box.WriteString("\n")
+	}
+
+	box.WriteString(lipgloss.NewStyle().Foreground(bc).Render("╰" + strings.Repeat("─", width+2) + "╯"))
+
+	return box.String()
+}
+
+// previewSize returns the content width and height of the context tab's preview box
+func (m Model) previewSize() (int, int) {
+	halfWidth := m.width / 2
+	if halfWidth < 30 {
+		halfWidth = 30
+	}
+	return halfWidth - 4, m.height - 2 - 2 // header + keys, borders
+}
+
+// previewLines builds the preview box content (project context excerpt, request
+// and the first files), cut to height lines
+func (m Model) previewLines(width int, height int) []string {
 	var lines []string
 
 	if m.context.ProjectContext != "" {
@@ -1792,10 +4581,9 @@ func (m Model) createBorderedPreviewBox(width int, height int) string {
 				lines = append(lines, dimStyle.Render("  ...truncated"))
 				break
 			}
-			if len(line) > width-4 {
-				line = line[:width-7] + "..."
+			for _, l := range fitLine(line, width-4, m.config.WrapText) {
+				lines = append(lines, "  "+l)
 			}
-			lines = append(lines, "  "+line)
 		}
 		lines = append(lines, dimStyle.Render("</project_context>"))
 		lines = append(lines, "")
@@ -1803,58 +4591,110 @@ func (m Model) createBorderedPreviewBox(width int, height int) string {
 
 	if m.context.Request != "" {
 		lines = append(lines, dimStyle.Render("<request>"))
-		rlines := strings.Split(m.context.Request, "\n")
-		for _, line := range rlines {
-			if len(line) > width-4 {
-				line = line[:width-7] + "..."
+		rlines := strings.Split(strings.TrimRight(m.context.Request, "\n"), "\n")
+
+		// Show only the first and last lines of a long request, if configured
+		head, tail := m.config.PreviewRequestHead, m.config.PreviewRequestTail
+		elided := 0
+		if head+tail > 0 && len(rlines) > head+tail {
+			elided = len(rlines) - head - tail
+		}
+		for i, line := range rlines {
+			if elided > 0 && i >= head && i < head+elided {
+				if i == head {
+					lines = append(lines, dimStyle.Render(fmt.Sprintf("  ... %d lines ...", elided)))
+				}
+				continue
+			}
+			for _, l := range fitLine(line, width-4, m.config.WrapText) {
+				lines = append(lines, "  "+l)
 			}
-			lines = append(lines, "  "+line)
 		}
 		lines = append(lines, dimStyle.Render("</request>"))
 		lines = append(lines, "")
 	}
 
 	lines = append(lines, dimStyle.Render("<files>"))
-	for i, f := range m.files {
+	shown := slices.DeleteFunc(slices.Clone(m.files), func(f FileInfo) bool { return f.Disabled })
+	for i, f := range shown {
 		if i >= 5 {
-			lines = append(lines, dimStyle.Render(fmt.Sprintf("  ... +%d more", len(m.files)-5)))
+			lines = append(lines, dimStyle.Render(fmt.Sprintf("  ... +%d more", len(shown)-5)))
 			break
 		}
-		path := f.Path
+		path := m.showPath(f.Path)
 		if len(path) > width-6 {
 			path = "..." + path[len(path)-width+9:]
 		}
-		lines = append(lines, "  "+path)
+		line := "  " + path
+		if note := m.context.Notes[f.Path]; note != "" && len(path)+8 < width {
+			runes := []rune(" # " + note)
+			if room := width - 4 - len(path); len(runes) > room {
+				runes = append(runes[:room-3], []rune("...")...)
+			}
+			line += dimStyle.Render(string(runes))
+		}
+		lines = append(lines, line)
 	}
 	lines = append(lines, dimStyle.Render("</files>"))
 
-	// Pad to height
-	for len(lines) < height {
-		lines = append(lines, "")
-	}
 	if len(lines) > height {
 		lines = lines[:height]
 	}
+	return lines
+}
 
-	// Build box
-	var box strings.Builder
-	title := "Preview"
+// copyShellCommand copies a ctx command that adds the context's files (see shellCommand)
+func (m *Model) copyShellCommand() tea.Cmd {
+	if len(m.context.Files) == 0 {
+		return m.setStatus("No files in context")
+	}
+	if err := CopyToClipboard(shellCommand(m.context, m.projectRoot()), m.config.VerifyClipboard); err != nil {
+		return m.setClipboardError(err)
+	}
+	return m.setStatus(fmt.Sprintf("Copied ctx command for %d files", len(m.context.Files)))
+}
 
-	box.WriteString(lipgloss.NewStyle().Foreground(bc).Render("╭─"))
-	box.WriteString(dimStyle.Render(title))
-	box.WriteString(lipgloss.NewStyle().Foreground(bc).Render(strings.Repeat("─", width-len(title)+1) + "╮"))
-	box.WriteString("\n")
+// copyInstructions copies a prompt with the project context and request but no
+// files, for follow-ups when the model already has them. Not saved to history.
+func (m *Model) copyInstructions() tea.Cmd {
+	if m.context.ProjectContext == "" && m.context.Request == "" {
+		return m.setStatus("Project context and request are both empty")
+	}
+	prompt := buildPrompt(m.config, promptInput{
+		ProjectContext: m.context.ProjectContext,
+		Request:        m.context.Request,
+		ProjectRoot:    m.projectRoot(),
+	})
+	if err := CopyToClipboard(prompt, m.config.VerifyClipboard); err != nil {
+		return m.setClipboardError(err)
+	}
+	return m.setStatus(fmt.Sprintf("Copied project context and request (%d files omitted)", len(m.context.Files)))
+}
 
-	for _, line := range lines {
-		box.WriteString(lipgloss.NewStyle().Foreground(bc).Render("│ "))
-		box.WriteString(padRight(line, width))
-		box.WriteString(lipgloss.NewStyle().Foreground(bc).Render(" │"))
-		box.WriteString("\n")
+// swapBoxes exchanges the Request and Project Context texts and saves
+func (m *Model) swapBoxes() tea.Cmd {
+	if m.context.Request == "" && m.context.ProjectContext == "" {
+		return m.setStatus("Request and Project Context are both empty")
+	}
+	m.context.Request, m.context.ProjectContext = m.context.ProjectContext, m.context.Request
+	if err := SaveContext(m.context); err != nil {
+		return m.setError("Error saving", err)
 	}
+	return m.setStatus("Swapped Request and Project Context")
+}
 
-	box.WriteString(lipgloss.NewStyle().Foreground(bc).Render("╰" + strings.Repeat("─", width+2) + "╯"))
+// copyPreview copies the preview box text, without styling, to the clipboard
+func (m *Model) copyPreview() tea.Cmd {
+	lines := m.previewLines(m.previewSize())
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(stripAnsi(line), " ")
+	}
+	text := strings.TrimRight(strings.Join(lines, "\n"), "\n") + "\n"
 
-	return box.String()
+	if err := CopyToClipboard(text, m.config.VerifyClipboard); err != nil {
+		return m.setClipboardError(err)
+	}
+	return m.setStatus(fmt.Sprintf("Copied preview (%d lines)", len(lines)))
 }
 
 func (m Model) boxTitle(title string, active bool) string {
@@ -1967,6 +4807,24 @@ func (m Model) renderPreviewContent(width int, height int) string {
 	return strings.Join(lines, "\n")
 }
 
+// fitLine fits a line into width columns: soft-wrapped at word boundaries when
+// wrap is on, otherwise truncated with "..."
+func fitLine(line string, width int, wrap bool) []string {
+	if len(line) <= width {
+		return []string{line}
+	}
+	if !wrap {
+		return []string{line[:width-3] + "..."}
+	}
+
+	wrapped := lipgloss.NewStyle().Width(width).Render(line)
+	parts := strings.Split(wrapped, "\n")
+	for i := range parts {
+		parts[i] = strings.TrimRight(parts[i], " ")
+	}
+	return parts
+}
+
 func padRight(s string, length int) string {
 	// Account for ANSI escape codes when calculating visible length
 	visible := stripAnsi(s)
@@ -1976,6 +4834,12 @@ func padRight(s string, length int) string {
 	return s + strings.Repeat(" ", length-len(visible))
 }
 
+// truncateWidth cuts s to at most width terminal cells without splitting a
+// multi-byte or wide character
+func truncateWidth(s string, width int) string {
+	return ansi.Truncate(s, width, "")
+}
+
 func stripAnsi(s string) string {
 	// Simple ANSI stripper - remove escape sequences
 	result := ""
@@ -2244,7 +5108,7 @@ func (m Model) viewFolders() string {
 
 	sb.WriteString(strings.Repeat("─", min(m.width, 60)))
 	sb.WriteString("\n")
-	sb.WriteString(dimStyle.Render("[d]elete folder  [space]select  [f]back to files  [q]uit"))
+	sb.WriteString(dimStyle.Render("[d]elete folder  [x]exclude  [space]select  [f]back to files  [q]uit"))
 	sb.WriteString("\n")
 
 	return sb.String()
@@ -2258,15 +5122,43 @@ func (m Model) viewSelect(title string) string {
 	sb.WriteString(strings.Repeat("─", min(m.width, 40)))
 	sb.WriteString("\n")
 
-	for i, item := range m.selectItems {
+	items := m.visibleSelectItems()
+	if m.selectFilterable() {
+		sb.WriteString("Filter: " + m.selectFilter + "_")
+		sb.WriteString("\n")
+		if len(items) == 0 {
+			sb.WriteString(dimStyle.Render("  (no matches)"))
+			sb.WriteString("\n")
+		}
+	}
+
+	for i, item := range items {
 		prefix := "  "
 		if i == m.selectCursor {
 			prefix = "> "
 		}
 
+		if m.mode == modeContextSelect {
+			if m.selectMarked[item] {
+				prefix += "[x] "
+			} else {
+				prefix += "    "
+			}
+		}
+
 		line := prefix + item
+		if m.mode == modeContextSelect {
+			if n := slices.Index(m.config.FavoriteContexts, item); n >= 0 {
+				line += fmt.Sprintf("  ★%d", n+1)
+			}
+		}
+		if _, ok := m.selectBroken[item]; ok && m.mode == modeContextSelect {
+			line += errorStyle.Render("  (can't load, see audit contexts)")
+		}
 		if i == m.selectCursor {
 			line = cursorStyle.Render(line)
+		} else if m.selectMarked[item] {
+			line = selectedStyle.Render(line)
 		}
 
 		sb.WriteString(line)
@@ -2277,7 +5169,9 @@ func (m Model) viewSelect(title string) string {
 	sb.WriteString("\n")
 	// Show delete hint only for context selection
 	if strings.Contains(title, "Context") {
-		sb.WriteString(dimStyle.Render("[enter] select  [D]elete  [esc] cancel"))
+		sb.WriteString(dimStyle.Render("type to filter  [enter] select  [space]mark  [^f]avorite  [^d]elete  [^a/^t] merge  [^l]eaderboard  [esc] cancel"))
+	} else if m.selectFilterable() {
+		sb.WriteString(dimStyle.Render("type to filter  [enter] select  [^r]eset to defaults  [esc] cancel"))
 	} else {
 		sb.WriteString(dimStyle.Render("[enter] select  [esc] cancel"))
 	}
@@ -2305,6 +5199,148 @@ func (m Model) viewInput(title string, value string) string {
 	return sb.String()
 }
 
+func (m Model) viewContextSizes() string {
+	var sb strings.Builder
+
+	sb.WriteString(titleStyle.Render("Contexts by Size"))
+	sb.WriteString("\n")
+	sb.WriteString(strings.Repeat("─", min(m.width, 50)))
+	sb.WriteString("\n")
+	sb.WriteString(dimStyle.Render(fmt.Sprintf("  %-24s %6s %9s %8s", "Context", "Files", "Size", "Missing")))
+	sb.WriteString("\n")
+
+	visibleRows := m.visibleFileRows() - 1
+	start := 0
+	if m.selectCursor >= visibleRows {
+		start = m.selectCursor - visibleRows + 1
+	}
+	for i := start; i < len(m.contextSizes) && i < start+visibleRows; i++ {
+		cs := m.contextSizes[i]
+		prefix := "  "
+		if i == m.selectCursor {
+			prefix = "> "
+		}
+		missing := ""
+		if cs.Missing > 0 {
+			missing = fmt.Sprintf("%d", cs.Missing)
+		}
+
+		line := fmt.Sprintf("%s%-24s %6d %9s %8s", prefix, cs.Name, cs.FileCount, formatSize(cs.TotalSize), missing)
+		if i == m.selectCursor {
+			line = cursorStyle.Render(line)
+		} else if cs.Name == m.context.Name {
+			line = selectedStyle.Render(line)
+		}
+		sb.WriteString(line)
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString(strings.Repeat("─", min(m.width, 50)))
+	sb.WriteString("\n")
+	sb.WriteString(dimStyle.Render("[enter] switch  [↑/↓] navigate  [esc] back"))
+	sb.WriteString("\n")
+
+	return sb.String()
+}
+
+// excludeTestSample is how many included/excluded paths the exclude test lists
+const excludeTestSample = 10
+
+func (m Model) viewExcludeTest() string {
+	var sb strings.Builder
+	res := m.excludeTest
+
+	includedStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("10"))
+
+	sb.WriteString(titleStyle.Render(fmt.Sprintf("Exclude Rule '%s'", m.exclude.Name)))
+	sb.WriteString("\n")
+	sb.WriteString(strings.Repeat("─", min(m.width, 60)))
+	sb.WriteString("\n")
+	sb.WriteString(fmt.Sprintf("Directory: %s\n", res.Dir))
+
+	excludedDirs := 0
+	for _, e := range res.Excluded {
+		if e.IsDir {
+			excludedDirs++
+		}
+	}
+	sb.WriteString(fmt.Sprintf("Included: %d files   Excluded: %d files, %d directories\n\n",
+		len(res.Included), len(res.Excluded)-excludedDirs, excludedDirs))
+
+	sb.WriteString(includedStyle.Render("Included:"))
+	sb.WriteString("\n")
+	for i, path := range res.Included {
+		if i >= excludeTestSample {
+			sb.WriteString(dimStyle.Render(fmt.Sprintf("  ... +%d more", len(res.Included)-i)))
+			sb.WriteString("\n")
+			break
+		}
+		sb.WriteString("  " + displayPath(path, res.Dir) + "\n")
+	}
+
+	sb.WriteString("\n")
+	sb.WriteString(errorStyle.Render("Excluded:"))
+	sb.WriteString("\n")
+	for i, e := range res.Excluded {
+		if i >= excludeTestSample {
+			sb.WriteString(dimStyle.Render(fmt.Sprintf("  ... +%d more", len(res.Excluded)-i)))
+			sb.WriteString("\n")
+			break
+		}
+		path := displayPath(e.Path, res.Dir)
+		if e.IsDir {
+			path += "/"
+		}
+		sb.WriteString("  " + path + dimStyle.Render("  ("+e.Pattern+")") + "\n")
+	}
+
+	sb.WriteString(strings.Repeat("─", min(m.width, 60)))
+	sb.WriteString("\n")
+	sb.WriteString(dimStyle.Render("[any key] close"))
+	sb.WriteString("\n")
+
+	return sb.String()
+}
+
+// viewSkipPrefixes shows the prefix input and the project names the current files
+// would get with it
+func (m Model) viewSkipPrefixes() string {
+	var sb strings.Builder
+
+	sb.WriteString(m.viewInput("Skip Prefixes (space or comma separated; empty restores the defaults)", m.inputBuffer))
+
+	prefixes := parseSkipPrefixes(m.inputBuffer)
+	if len(prefixes) == 0 {
+		prefixes = DefaultConfig().SkipPrefixes
+	}
+
+	sb.WriteString("\n")
+	sb.WriteString(titleStyle.Render("Preview"))
+	sb.WriteString("\n")
+	if len(m.files) == 0 {
+		sb.WriteString(dimStyle.Render("  (no files in context)"))
+		sb.WriteString("\n")
+	}
+
+	maxRows := max(m.height-12, 3)
+	for i, f := range m.files {
+		if i == maxRows {
+			sb.WriteString(dimStyle.Render(fmt.Sprintf("  ... %d more", len(m.files)-i)))
+			sb.WriteString("\n")
+			break
+		}
+		project, rel := splitProject(f.Path, prefixes)
+		line := fmt.Sprintf("  [%s] %s", project, rel)
+		if project != f.Project {
+			line = warningStyle.Render(line) + dimStyle.Render("  (was "+f.Project+")")
+		}
+		sb.WriteString(line)
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
 func (m Model) viewConfig() string {
 	var sb strings.Builder
 
@@ -2312,17 +5348,115 @@ func (m Model) viewConfig() string {
 	sb.WriteString("\n")
 	sb.WriteString(strings.Repeat("─", min(m.width, 40)))
 	sb.WriteString("\n")
-	sb.WriteString(fmt.Sprintf("Context: %s\n", m.config.ActiveContext))
-	sb.WriteString(fmt.Sprintf("Exclude: %s\n", m.config.ActiveExclude))
+	if m.context.SourcePath != "" {
+		sb.WriteString(fmt.Sprintf("Context: %s (from %s)\n", m.context.Name, m.showPath(m.context.SourcePath)))
+	} else {
+		sb.WriteString(fmt.Sprintf("Context: %s\n", m.config.ActiveContext))
+	}
+	if m.context.ExcludeRule != "" {
+		sb.WriteString(fmt.Sprintf("Exclude: %s (context override, global: %s)\n", m.exclude.Name, m.config.ActiveExclude))
+	} else {
+		sb.WriteString(fmt.Sprintf("Exclude: %s\n", m.exclude.Name))
+	}
 	sb.WriteString(fmt.Sprintf("Skip prefixes: %v\n", m.config.SkipPrefixes))
+	switch {
+	case m.context.ProjectRoot != "":
+		sb.WriteString(fmt.Sprintf("Project root: %s\n", m.showPath(m.context.ProjectRoot)))
+	case m.config.ProjectRoot != "":
+		sb.WriteString(fmt.Sprintf("Project root: %s (from %s)\n", m.showPath(m.config.ProjectRoot), m.showPath(m.config.ProjectConfig)))
+	default:
+		sb.WriteString("Project root: (not set)\n")
+	}
 	sb.WriteString(strings.Repeat("─", min(m.width, 40)))
 	sb.WriteString("\n")
+	sb.WriteString(dimStyle.Render("[e] edit skip prefixes  [o] open config dir  [any key] close"))
+	sb.WriteString("\n")
+
+	return sb.String()
+}
+
+// languageStats aggregates the files of one language for the stats screen
+type languageStats struct {
+	Language string
+	Files    int
+	Lines    int
+	Size     int64
+}
+
+func (m Model) viewStats() string {
+	var sb strings.Builder
+
+	sb.WriteString(titleStyle.Render("Context Stats"))
+	sb.WriteString("\n")
+	sb.WriteString(strings.Repeat("─", min(m.width, 50)))
+	sb.WriteString("\n")
+	sb.WriteString(fmt.Sprintf("Files:  %d\n", len(m.files)))
+	sb.WriteString(fmt.Sprintf("Size:   %s\n", formatSize(m.totalSize())))
+	sb.WriteString(fmt.Sprintf("Lines:  %d\n", m.totalLines()))
+	sb.WriteString(fmt.Sprintf("Tokens: ~%s\n", formatTokens(estimateTokens(m.totalSize()))))
+	sb.WriteString("\n")
+
+	// Group by language
+	byLang := make(map[string]*languageStats)
+	for _, f := range m.files {
+		lang := languageForPath(f.Path)
+		st, ok := byLang[lang]
+		if !ok {
+			st = &languageStats{Language: lang}
+			byLang[lang] = st
+		}
+		st.Files++
+		st.Lines += f.Lines
+		st.Size += f.Size
+	}
+	stats := make([]languageStats, 0, len(byLang))
+	for _, st := range byLang {
+		stats = append(stats, *st)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Lines != stats[j].Lines {
+			return stats[i].Lines > stats[j].Lines
+		}
+		return stats[i].Language < stats[j].Language
+	})
+
+	sb.WriteString(dimStyle.Render(fmt.Sprintf("%-14s %6s %8s %8s", "Language", "Files", "Lines", "Size")))
+	sb.WriteString("\n")
+	for _, st := range stats {
+		sb.WriteString(fmt.Sprintf("%-14s %6d %8d %8s\n", st.Language, st.Files, st.Lines, formatSize(st.Size)))
+	}
+
+	sb.WriteString(strings.Repeat("─", min(m.width, 50)))
+	sb.WriteString("\n")
 	sb.WriteString(dimStyle.Render("[any key] close"))
 	sb.WriteString("\n")
 
 	return sb.String()
 }
 
+// prettyPath collapses the home directory prefix of path to ~ for display
+func prettyPath(path string) string {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" {
+		return path
+	}
+	if path == home {
+		return "~"
+	}
+	if strings.HasPrefix(path, home+"/") {
+		return "~" + strings.TrimPrefix(path, home)
+	}
+	return path
+}
+
+// showPath returns path as it should be displayed: ~-collapsed unless full_paths is set
+func (m Model) showPath(path string) string {
+	if m.config.FullPaths {
+		return path
+	}
+	return prettyPath(path)
+}
+
 func formatSize(size int64) string {
 	if size < 1024 {
 		return fmt.Sprintf("%dB", size)
@@ -2330,6 +5464,34 @@ func formatSize(size int64) string {
 	return fmt.Sprintf("%dKB", size/1024)
 }
 
+// clipboardErrorStatus returns the status message for a failed clipboard copy
+func clipboardErrorStatus(err error) string {
+	if errors.Is(err, ErrClipboardVerify) {
+		return "Clipboard verification failed: nothing landed on the clipboard"
+	}
+	return fmt.Sprintf("Clipboard error: %v", err)
+}
+
+// formatElapsed formats a duration for the status line: "340ms" below a second, else "1.25s"
+func formatElapsed(d time.Duration) string {
+	if d < time.Second {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+	return fmt.Sprintf("%.2fs", d.Seconds())
+}
+
+// estimateTokens returns a rough token count for a prompt of the given byte size (~4 bytes per token)
+func estimateTokens(bytes int64) int {
+	return int((bytes + 3) / 4)
+}
+
+func formatTokens(tokens int) string {
+	if tokens < 1000 {
+		return fmt.Sprintf("%d", tokens)
+	}
+	return fmt.Sprintf("%.1fk", float64(tokens)/1000)
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -2345,7 +5507,17 @@ func max(a, b int) int {
 }
 
 func main() {
-	p := tea.NewProgram(initialModel(), tea.WithAltScreen())
+	// Headless commands run without the TUI
+	handled, contextFile, err := runCLI(os.Args[1:])
+	if handled {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	p := tea.NewProgram(initialModel(contextFile), tea.WithAltScreen())
 	if _, err := p.Run(); err != nil {
 		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
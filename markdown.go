@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// stripFrontmatter removes a leading YAML frontmatter block (between --- lines)
+func stripFrontmatter(content string) string {
+	if !strings.HasPrefix(content, "---\n") && !strings.HasPrefix(content, "---\r\n") {
+		return content
+	}
+	lines := strings.SplitAfter(content, "\n")
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == "---" {
+			return strings.Join(lines[i+1:], "")
+		}
+	}
+	return content // Unterminated frontmatter: leave as is
+}
+
+// headingLevel returns the level of a markdown ATX heading line (1 for "# Foo")
+// and its text, or 0 if the line isn't a heading
+func headingLevel(line string) (int, string) {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || level >= len(line) || line[level] != ' ' {
+		return 0, ""
+	}
+	return level, strings.TrimSpace(strings.Trim(line[level:], " #"))
+}
+
+// extractMarkdownSection returns the body of the section titled heading
+// (case-insensitive), up to the next heading of the same or a higher level.
+// With an empty heading the whole document is returned. Frontmatter is dropped.
+func extractMarkdownSection(content string, heading string) (string, error) {
+	content = stripFrontmatter(content)
+	if heading == "" {
+		return strings.TrimSpace(content) + "\n", nil
+	}
+
+	var section []string
+	sectionLevel := 0
+	inFence := false
+	for _, line := range strings.Split(content, "\n") {
+		// Lines starting with # inside code blocks aren't headings
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+		}
+
+		level, text := 0, ""
+		if !inFence {
+			level, text = headingLevel(strings.TrimRight(line, "\r"))
+		}
+
+		if sectionLevel == 0 {
+			if level > 0 && strings.EqualFold(text, heading) {
+				sectionLevel = level
+			}
+			continue
+		}
+		if level > 0 && level <= sectionLevel {
+			break
+		}
+		section = append(section, line)
+	}
+
+	if sectionLevel == 0 {
+		return "", fmt.Errorf("section %q not found", heading)
+	}
+	return strings.TrimSpace(strings.Join(section, "\n")) + "\n", nil
+}
+
+// SyncProjectContext re-reads ProjectContext from its source file (and section)
+func (ctx *Context) SyncProjectContext() error {
+	if ctx.ProjectContextFile == "" {
+		return fmt.Errorf("project context has no source file")
+	}
+
+	data, err := os.ReadFile(ctx.ProjectContextFile)
+	if err != nil {
+		return err
+	}
+
+	text, err := extractMarkdownSection(string(data), ctx.ProjectContextSection)
+	if err != nil {
+		return err
+	}
+	ctx.ProjectContext = text
+	return nil
+}
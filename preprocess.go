@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// lineCommentPrefixes maps languages (as returned by languageForPath) to their
+// line comment markers
+var lineCommentPrefixes = map[string]string{
+	"Go":         "//",
+	"JavaScript": "//",
+	"TypeScript": "//",
+	"Rust":       "//",
+	"Java":       "//",
+	"Kotlin":     "//",
+	"Swift":      "//",
+	"C":          "//",
+	"C++":        "//",
+	"C#":         "//",
+	"PHP":        "//",
+	"SCSS":       "//",
+	"Python":     "#",
+	"Ruby":       "#",
+	"Shell":      "#",
+	"YAML":       "#",
+	"TOML":       "#",
+	"Makefile":   "#",
+	"Dockerfile": "#",
+	"SQL":        "--",
+	"Lua":        "--",
+}
+
+// lineFilter selects what preprocessContent and numberLines drop. Either option
+// also collapses runs of blank lines to one.
+type lineFilter struct {
+	comments bool // strip_comments: drop comment-only lines, trim trailing whitespace
+	edges    bool // trim_blank_lines: drop leading and trailing blank lines
+}
+
+// active reports whether the filter changes anything
+func (lf lineFilter) active() bool {
+	return lf.comments || lf.edges
+}
+
+// preprocessContent shrinks file content for the prompt. With lf.comments,
+// trailing whitespace is trimmed and lines consisting only of a line comment
+// are dropped (for known languages); comments after code are kept, since the
+// marker may be inside a string. With lf.edges, blank lines at the start and
+// end are dropped. Runs of blank lines are collapsed to one either way.
+// The input slice is not modified.
+func preprocessContent(content []byte, lang string, lf lineFilter) []byte {
+	lines, trailingNewline := contentLines(content)
+
+	kept := keptLines(lines, lang, lf)
+
+	var out bytes.Buffer
+	out.Grow(len(content))
+	for n, i := range kept {
+		if n > 0 {
+			out.WriteByte('\n')
+		}
+		out.WriteString(filterLine(lines[i], lf))
+	}
+	if trailingNewline && len(kept) > 0 {
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
+
+// contentLines splits content into lines; a trailing newline doesn't start another line
+func contentLines(content []byte) ([]string, bool) {
+	lines := strings.Split(string(content), "\n")
+	trailingNewline := len(lines) > 1 && lines[len(lines)-1] == ""
+	if trailingNewline {
+		lines = lines[:len(lines)-1]
+	}
+	return lines, trailingNewline
+}
+
+// filterLine trims trailing whitespace with lf.comments, and empties blank lines
+func filterLine(line string, lf lineFilter) string {
+	if lf.comments || strings.TrimSpace(line) == "" {
+		return strings.TrimRight(line, " \t\r")
+	}
+	return line
+}
+
+// keptLines returns the indexes of the lines preprocessContent keeps
+func keptLines(lines []string, lang string, lf lineFilter) []int {
+	prefix := ""
+	if lf.comments {
+		prefix = lineCommentPrefixes[lang]
+	}
+
+	var kept []int
+	blank := lf.edges // a blank first line is dropped like a repeated one
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		if prefix != "" && strings.HasPrefix(trimmed, prefix) && !isDirectiveComment(trimmed) {
+			continue
+		}
+
+		if trimmed == "" {
+			if blank {
+				continue
+			}
+			blank = true
+		} else {
+			blank = false
+		}
+
+		kept = append(kept, i)
+	}
+
+	// At most one blank line is left at the end
+	if lf.edges && blank && len(kept) > 0 {
+		kept = kept[:len(kept)-1]
+	}
+	return kept
+}
+
+// numberLines prefixes each line with its right-aligned line number ("  7 | ").
+// With an active filter, the lines preprocessContent would drop are left out,
+// and the kept lines keep their numbers in the original file.
+func numberLines(content []byte, lang string, lf lineFilter) []byte {
+	lines, trailingNewline := contentLines(content)
+
+	var kept []int
+	if lf.active() {
+		kept = keptLines(lines, lang, lf)
+	} else {
+		kept = make([]int, len(lines))
+		for i := range lines {
+			kept[i] = i
+		}
+	}
+
+	width := len(strconv.Itoa(len(lines)))
+	var out bytes.Buffer
+	out.Grow(len(content) + len(kept)*(width+3))
+	for n, i := range kept {
+		line := lines[i]
+		if lf.active() {
+			line = filterLine(line, lf)
+		}
+		if n > 0 {
+			out.WriteByte('\n')
+		}
+		fmt.Fprintf(&out, "%*d |", width, i+1)
+		if line != "" {
+			out.WriteString(" " + line)
+		}
+	}
+	if trailingNewline && len(kept) > 0 {
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
+
+// isDirectiveComment reports whether a comment line carries meaning for tooling
+// (shebangs, //go: directives, build constraints) and must be kept
+func isDirectiveComment(line string) bool {
+	return strings.HasPrefix(line, "#!") ||
+		strings.HasPrefix(line, "//go:") ||
+		strings.HasPrefix(line, "// +build")
+}
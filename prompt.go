@@ -0,0 +1,520 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// promptPreamble explains the structure of the prompt to the LLM
+const promptPreamble = `This is a structured prompt for a software development task.
+
+<project_context> describes the project: its purpose, tech stack, architecture, and coding conventions. Use this to understand the broader context.
+
+<request> contains the specific task or question to address. This is what you should focus on accomplishing.
+
+<file> tags contain the relevant source files. Each file has a path attribute. Use these to understand the current implementation and make appropriate changes.
+
+---
+
+`
+
+// promptInput holds everything needed to build a prompt
+type promptInput struct {
+	ProjectContext string
+	Request        string
+	ProjectRoot    string            // if set, file paths are shown relative to it
+	Files          []string          // absolute paths, in output order
+	Notes          map[string]string // per-file notes keyed by absolute path
+	GitDiff        string            // emitted as a <git_diff> section after the files
+	Cache          *fileCache        // if set, file contents are read through it
+
+	// Progress, if set, is called after each file is read
+	Progress func(done, total int)
+}
+
+// promptFile is a file that was read for inclusion in a prompt
+type promptFile struct {
+	AbsPath  string // path on disk
+	Path     string // display path (relative to the project root if set)
+	Note     string
+	Content  []byte
+	Size     int64     // size on disk, for include_file_meta
+	Modified time.Time // mtime, for include_file_meta
+	Hash     string    // sha256 prefix of the content as read, for include_manifest
+	Source   *os.File  // if set, Content is nil and the file is copied from it when written
+}
+
+// streamThreshold is the size above which a file is copied from disk straight into
+// the prompt when it is written, instead of being read into memory first
+const streamThreshold = 4 << 20
+
+// streamable reports whether file contents go into the prompt unchanged, which
+// streaming requires: XML output without any option that rewrites or hashes content
+func streamable(cfg Config) bool {
+	return cfg.OutputFormat != formatJSON && !cfg.StripComments && !cfg.TrimBlankLines &&
+		!cfg.LineNumbers && !cfg.EscapeFileContents && !cfg.IncludeManifest
+}
+
+// manifestHashLen is the number of hex digits of each file's sha256 in the manifest
+const manifestHashLen = 12
+
+// contentHash returns the manifest hash of content: the first manifestHashLen hex
+// digits of its sha256, so `sha256sum file` can be checked against it
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])[:manifestHashLen]
+}
+
+// statPromptFile fills in the size and mtime of f from the file at path
+func statPromptFile(f *promptFile, path string) {
+	if stat, err := os.Stat(path); err == nil {
+		f.Size = stat.Size()
+		f.Modified = stat.ModTime()
+	}
+}
+
+// maxNoteLen is the longest note (in runes) emitted in a file tag
+const maxNoteLen = 200
+
+// noteAttr returns note as a safe XML attribute value: whitespace collapsed to
+// single spaces, truncated to maxNoteLen runes and escaped
+func noteAttr(note string) string {
+	note = strings.Join(strings.Fields(note), " ")
+	if runes := []rune(note); len(runes) > maxNoteLen {
+		note = string(runes[:maxNoteLen-3]) + "..."
+	}
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(note))
+	return buf.String()
+}
+
+// Output formats for the built prompt
+const (
+	formatXML  = "xml"
+	formatJSON = "json"
+)
+
+// buildPrompt assembles the clipboard output for the live context and history entries
+// in the configured output format. Files that can't be read are skipped.
+func buildPrompt(cfg Config, in promptInput) string {
+	prompt, _ := buildPromptFiles(cfg, in)
+	return prompt
+}
+
+// buildPromptFiles is buildPrompt, also returning the paths of the files the prompt
+// contains (the input files minus those that couldn't be read), in order
+func buildPromptFiles(cfg Config, in promptInput) (string, []string) {
+	files := collectPromptFiles(in, streamable(cfg))
+	defer closePromptFiles(files)
+
+	included := make([]string, len(files))
+	for i, f := range files {
+		included[i] = f.AbsPath
+		if cfg.IncludeManifest {
+			files[i].Hash = contentHash(f.Content) // the file as on disk, before processing
+		}
+		files[i].Content = processContent(cfg, f)
+	}
+
+	if cfg.OutputFormat == formatJSON {
+		return buildJSONPrompt(cfg, in, files), included
+	}
+	return buildXMLPrompt(cfg, in, files), included
+}
+
+// processContent applies the strip_comments and line_numbers options to a file's content
+func processContent(cfg Config, f promptFile) []byte {
+	lang := languageForPath(f.Path)
+	lf := lineFilter{comments: cfg.StripComments, edges: cfg.TrimBlankLines}
+	switch {
+	case cfg.LineNumbers:
+		return numberLines(f.Content, lang, lf)
+	case lf.active():
+		return preprocessContent(f.Content, lang, lf)
+	}
+	return f.Content
+}
+
+// collectPromptFiles reads the input files, skipping any that can't be read. With
+// stream, files over streamThreshold aren't read but opened, to be copied from disk
+// when written; the caller closes them with closePromptFiles.
+func collectPromptFiles(in promptInput, stream bool) []promptFile {
+	var files []promptFile
+	for i, path := range in.Files {
+		if in.Progress != nil {
+			in.Progress(i+1, len(in.Files))
+		}
+
+		f := promptFile{
+			AbsPath: path,
+			Path:    displayPath(path, in.ProjectRoot),
+			Note:    in.Notes[path],
+		}
+		statPromptFile(&f, path)
+		if stream && f.Size > streamThreshold {
+			src, err := os.Open(path)
+			if err != nil {
+				continue // Skip files that can't be read
+			}
+			f.Source = src
+			files = append(files, f)
+			continue
+		}
+
+		var content []byte
+		var err error
+		if in.Cache != nil {
+			content, err = in.Cache.ReadFile(path)
+		} else {
+			content, err = os.ReadFile(path)
+		}
+		if err != nil {
+			continue // Skip files that can't be read
+		}
+		f.Content = content
+		files = append(files, f)
+	}
+	return files
+}
+
+// closePromptFiles closes the files opened for streaming by collectPromptFiles
+func closePromptFiles(files []promptFile) {
+	for _, f := range files {
+		if f.Source != nil {
+			f.Source.Close()
+		}
+	}
+}
+
+func buildXMLPrompt(cfg Config, in promptInput, files []promptFile) string {
+	var sb strings.Builder
+
+	// Write preamble explaining the structure
+	if cfg.Preamble != "" {
+		sb.WriteString(cfg.Preamble)
+		if !strings.HasSuffix(cfg.Preamble, "\n") {
+			sb.WriteString("\n")
+		}
+		sb.WriteString("\n---\n\n")
+	} else {
+		sb.WriteString(promptPreamble)
+	}
+
+	// Write project context
+	if in.ProjectContext != "" {
+		sb.WriteString("<project_context>\n")
+		sb.WriteString(in.ProjectContext)
+		if !strings.HasSuffix(in.ProjectContext, "\n") {
+			sb.WriteString("\n")
+		}
+		sb.WriteString("</project_context>\n\n")
+	}
+
+	// Write request
+	if in.Request != "" {
+		sb.WriteString("<request>\n")
+		sb.WriteString(in.Request)
+		if !strings.HasSuffix(in.Request, "\n") {
+			sb.WriteString("\n")
+		}
+		sb.WriteString("</request>\n\n")
+	}
+
+	// Write file tree overview
+	if cfg.IncludeTree && len(in.Files) > 0 {
+		sb.WriteString("<file_tree>\n")
+		sb.WriteString(renderFileTree(in.Files, in.ProjectRoot))
+		sb.WriteString("</file_tree>\n\n")
+	}
+
+	// Write files
+	for _, f := range files {
+		writeXMLFile(&sb, cfg, f)
+	}
+
+	// Write uncommitted changes
+	if in.GitDiff != "" {
+		diff := []byte(in.GitDiff)
+		if cfg.EscapeFileContents {
+			diff = wrapCDATA(diff)
+		}
+		sb.WriteString("<git_diff>\n")
+		sb.Write(diff)
+		if diff[len(diff)-1] != '\n' {
+			sb.WriteString("\n")
+		}
+		sb.WriteString("</git_diff>\n\n")
+	}
+
+	// Write the manifest of included files
+	if cfg.IncludeManifest && len(files) > 0 {
+		sb.WriteString("<manifest>\n")
+		for _, f := range files {
+			sb.WriteString(fmt.Sprintf("%s sha256:%s\n", f.Path, f.Hash))
+		}
+		sb.WriteString("</manifest>\n\n")
+	}
+
+	return sb.String()
+}
+
+// writeXMLFile writes one file wrapped in its <file> tag. A file with a Source is
+// copied from it.
+func writeXMLFile(sb *strings.Builder, cfg Config, f promptFile) {
+	content := f.Content
+	if cfg.EscapeFileContents {
+		content = wrapCDATA(content)
+	}
+
+	sb.WriteString(fmt.Sprintf("<file path=\"%s\"", f.Path))
+	if cfg.IncludeFileMeta && !f.Modified.IsZero() {
+		sb.WriteString(fmt.Sprintf(" size=\"%d\" modified=\"%s\"", f.Size, f.Modified.Format(time.RFC3339)))
+	}
+	if f.Note != "" {
+		sb.WriteString(fmt.Sprintf(" note=\"%s\"", noteAttr(f.Note)))
+	}
+	sb.WriteString(">\n")
+	if f.Source != nil {
+		writeStream(sb, f.Source, f.Size)
+	} else {
+		sb.Write(content)
+		if len(content) > 0 && content[len(content)-1] != '\n' {
+			sb.WriteString("\n")
+		}
+	}
+	sb.WriteString("</file>\n\n")
+}
+
+// writeStream copies r (about size bytes) into sb in chunks, ending it with a
+// newline like writeXMLFile does for in-memory content. A read error ends the
+// copy early; what was read so far stays in the prompt.
+func writeStream(sb *strings.Builder, r io.Reader, size int64) {
+	sb.Grow(int(size) + 1)
+	w := &lastByteWriter{w: sb}
+	io.Copy(w, r)
+	if w.n > 0 && w.last != '\n' {
+		sb.WriteString("\n")
+	}
+}
+
+// lastByteWriter passes writes through to w, counting the bytes and keeping the last one
+type lastByteWriter struct {
+	w    io.Writer
+	n    int64
+	last byte
+}
+
+func (lw *lastByteWriter) Write(p []byte) (int, error) {
+	n, err := lw.w.Write(p)
+	if n > 0 {
+		lw.n += int64(n)
+		lw.last = p[n-1]
+	}
+	return n, err
+}
+
+// buildFilePrompt wraps a single file exactly as buildPrompt would (without the
+// preamble, request or project context)
+func buildFilePrompt(cfg Config, path string, root string, note string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	f := promptFile{Path: displayPath(path, root), Note: note, Content: content}
+	statPromptFile(&f, path)
+	f.Content = processContent(cfg, f)
+
+	if cfg.OutputFormat == formatJSON {
+		data, err := json.MarshalIndent(newJSONFile(cfg, f), "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(data) + "\n", nil
+	}
+
+	var sb strings.Builder
+	writeXMLFile(&sb, cfg, f)
+	return sb.String(), nil
+}
+
+// markdownPrompt wraps a built prompt in a markdown document: a comment naming the
+// context and export time, a heading, and the prompt in a fenced code block
+func markdownPrompt(cfg Config, name string, prompt string, now time.Time) string {
+	lang := formatXML
+	if cfg.OutputFormat == formatJSON {
+		lang = formatJSON
+	}
+
+	// The fence must be longer than any backtick run inside the prompt
+	longest, run := 0, 0
+	for _, c := range prompt {
+		if c == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", max(3, longest+1))
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("<!-- Generated by ctx from context %q on %s -->\n\n", name, now.Format("2006-01-02 15:04:05")))
+	sb.WriteString("# " + name + "\n\n")
+	sb.WriteString(fence + lang + "\n")
+	sb.WriteString(strings.TrimRight(prompt, "\n"))
+	sb.WriteString("\n" + fence + "\n")
+	return sb.String()
+}
+
+// jsonPrompt is the structure emitted by the JSON output format
+type jsonPrompt struct {
+	ProjectContext string     `json:"project_context"`
+	Request        string     `json:"request"`
+	FileTree       string     `json:"file_tree,omitempty"`
+	Files          []jsonFile `json:"files"`
+	GitDiff        string     `json:"git_diff,omitempty"`
+	Manifest       []jsonHash `json:"manifest,omitempty"`
+}
+
+// jsonHash is one manifest entry of the JSON output format
+type jsonHash struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"` // prefix, see contentHash
+}
+
+type jsonFile struct {
+	Path     string `json:"path"`
+	Note     string `json:"note,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+	Modified string `json:"modified,omitempty"`
+	Content  string `json:"content"`
+}
+
+// newJSONFile converts f, with its size and mtime if include_file_meta is set
+func newJSONFile(cfg Config, f promptFile) jsonFile {
+	jf := jsonFile{Path: f.Path, Note: f.Note, Content: string(f.Content)}
+	if cfg.IncludeFileMeta && !f.Modified.IsZero() {
+		jf.Size = f.Size
+		jf.Modified = f.Modified.Format(time.RFC3339)
+	}
+	return jf
+}
+
+// buildJSONPrompt emits the prompt as a JSON object. encoding/json escapes
+// control characters and replaces invalid UTF-8, so the output is always valid.
+func buildJSONPrompt(cfg Config, in promptInput, files []promptFile) string {
+	out := jsonPrompt{
+		ProjectContext: in.ProjectContext,
+		Request:        in.Request,
+		Files:          []jsonFile{},
+		GitDiff:        in.GitDiff,
+	}
+	if cfg.IncludeTree && len(in.Files) > 0 {
+		out.FileTree = renderFileTree(in.Files, in.ProjectRoot)
+	}
+	for _, f := range files {
+		out.Files = append(out.Files, newJSONFile(cfg, f))
+		if cfg.IncludeManifest {
+			out.Manifest = append(out.Manifest, jsonHash{Path: f.Path, SHA256: f.Hash})
+		}
+	}
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return "" // Can't happen: all fields are strings
+	}
+	return string(data) + "\n"
+}
+
+// wrapCDATA wraps file content in a CDATA section so a literal </file> inside it
+// can't be mistaken for the closing tag. Any "]]>" in the content is split across
+// two sections.
+func wrapCDATA(content []byte) []byte {
+	escaped := bytes.ReplaceAll(content, []byte("]]>"), []byte("]]]]><![CDATA[>"))
+
+	var buf bytes.Buffer
+	buf.WriteString("<![CDATA[\n")
+	buf.Write(escaped)
+	if len(escaped) > 0 && escaped[len(escaped)-1] != '\n' {
+		buf.WriteString("\n")
+	}
+	buf.WriteString("]]>")
+	return buf.Bytes()
+}
+
+// displayPath returns path relative to root if it lies under it, otherwise path unchanged
+func displayPath(path string, root string) string {
+	if root == "" {
+		return path
+	}
+	if !strings.HasSuffix(root, "/") {
+		root += "/"
+	}
+	if strings.HasPrefix(path, root) {
+		return strings.TrimPrefix(path, root)
+	}
+	return path
+}
+
+// treeNode is a directory or file in a rendered file tree
+type treeNode struct {
+	children map[string]*treeNode
+}
+
+// renderFileTree renders paths (relative to root) as an indented tree, directories first
+func renderFileTree(paths []string, root string) string {
+	tree := &treeNode{children: make(map[string]*treeNode)}
+	for _, p := range paths {
+		node := tree
+		for _, part := range strings.Split(strings.TrimPrefix(displayPath(p, root), "/"), "/") {
+			child, ok := node.children[part]
+			if !ok {
+				child = &treeNode{children: make(map[string]*treeNode)}
+				node.children[part] = child
+			}
+			node = child
+		}
+	}
+
+	var sb strings.Builder
+	writeTreeNode(&sb, tree, 0)
+	return sb.String()
+}
+
+func writeTreeNode(sb *strings.Builder, node *treeNode, depth int) {
+	names := make([]string, 0, len(node.children))
+	for name := range node.children {
+		names = append(names, name)
+	}
+
+	// Directories first, then alphabetically
+	sort.Slice(names, func(i, j int) bool {
+		iDir := len(node.children[names[i]].children) > 0
+		jDir := len(node.children[names[j]].children) > 0
+		if iDir != jDir {
+			return iDir
+		}
+		return names[i] < names[j]
+	})
+
+	for _, name := range names {
+		child := node.children[name]
+		sb.WriteString(strings.Repeat("  ", depth))
+		sb.WriteString(name)
+		if len(child.children) > 0 {
+			sb.WriteString("/")
+		}
+		sb.WriteString("\n")
+		writeTreeNode(sb, child, depth+1)
+	}
+}
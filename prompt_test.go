@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestBuildPromptStreamsLargeFiles(t *testing.T) {
+	dir := t.TempDir()
+	small := filepath.Join(dir, "small.go")
+	if err := os.WriteFile(small, []byte("package main"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		tail string
+	}{
+		{"trailing newline", "end\n"},
+		{"no trailing newline", "end"},
+	} {
+		big := filepath.Join(dir, "big.txt")
+		content := append(bytes.Repeat([]byte("0123456789abcde\n"), streamThreshold/16), tc.tail...)
+		if err := os.WriteFile(big, content, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		var cfg Config
+		in := promptInput{Request: "Review", ProjectRoot: dir, Files: []string{small, big}}
+
+		files := collectPromptFiles(in, true)
+		streamed := files[1].Source != nil
+		closePromptFiles(files)
+		if !streamed {
+			t.Fatalf("%s: large file was read instead of streamed", tc.name)
+		}
+
+		got := buildPrompt(cfg, in)
+		want := buildXMLPrompt(cfg, in, collectPromptFiles(in, false))
+		if got != want {
+			t.Errorf("%s: streamed prompt differs from the buffered one (len %d, want %d)", tc.name, len(got), len(want))
+		}
+	}
+}
+
+func TestBuildPromptFilesSkipsUnreadable(t *testing.T) {
+	dir := t.TempDir()
+	kept := filepath.Join(dir, "kept.go")
+	if err := os.WriteFile(kept, []byte("package main\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing.go")
+
+	_, included := buildPromptFiles(Config{}, promptInput{Files: []string{missing, kept}})
+	if !slices.Equal(included, []string{kept}) {
+		t.Errorf("included = %v, want %v", included, []string{kept})
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// syntheticFiles returns n files spread over 20 directories with distinct sizes,
+// every seventh one pinned
+func syntheticFiles(n int) []FileInfo {
+	files := make([]FileInfo, n)
+	for i := range files {
+		files[i] = FileInfo{
+			Path:   fmt.Sprintf("/src/project/dir%02d/file%04d.go", i%20, i),
+			Size:   int64((i * 7919) % 100000),
+			Exists: true,
+			Pinned: i%7 == 0,
+		}
+	}
+	return files
+}
+
+func TestSortFiles(t *testing.T) {
+	files := []FileInfo{
+		{Path: "/b", Size: 10},
+		{Path: "/a", Size: 30},
+		{Path: "/c", Size: 20, Pinned: true},
+		{Path: "/d", Size: 40},
+	}
+
+	for _, tc := range []struct {
+		mode string
+		want []string
+	}{
+		{sortSize, []string{"/c", "/d", "/a", "/b"}},
+		{sortName, []string{"/c", "/a", "/b", "/d"}},
+		{sortCustom, []string{"/c", "/b", "/a", "/d"}},
+	} {
+		sorted := append([]FileInfo(nil), files...)
+		sortFiles(sorted, tc.mode)
+		for i, f := range sorted {
+			if f.Path != tc.want[i] {
+				t.Errorf("%s: position %d = %s, want %s", tc.mode, i, f.Path, tc.want[i])
+			}
+		}
+	}
+}
+
+func TestGroupFolders(t *testing.T) {
+	folders := groupFolders([]FileInfo{
+		{Path: "/p/b/x.go", Size: 5},
+		{Path: "/p/a/y.go", Size: 1},
+		{Path: "/p/b/z.go", Size: 7},
+	})
+
+	want := []FolderInfo{
+		{Path: "/p/a", FileCount: 1, TotalSize: 1},
+		{Path: "/p/b", FileCount: 2, TotalSize: 12},
+	}
+	if len(folders) != len(want) {
+		t.Fatalf("got %d folders, want %d", len(folders), len(want))
+	}
+	for i := range want {
+		if folders[i] != want[i] {
+			t.Errorf("folder %d = %+v, want %+v", i, folders[i], want[i])
+		}
+	}
+}
+
+func BenchmarkSortFiles(b *testing.B) {
+	files := syntheticFiles(1000)
+	work := make([]FileInfo, len(files))
+	for _, mode := range []string{sortSize, sortName, sortCustom} {
+		b.Run(mode, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				copy(work, files)
+				sortFiles(work, mode)
+			}
+		})
+	}
+}
+
+func BenchmarkGroupFolders(b *testing.B) {
+	files := syntheticFiles(1000)
+	for i := 0; i < b.N; i++ {
+		groupFolders(files)
+	}
+}
+
+// In missing-only mode files is a separate slice; updates must reach allFiles too
+func TestMissingOnlyUpdatesAllFiles(t *testing.T) {
+	tempConfigDir(t)
+	dir := t.TempDir()
+	present, missing := filepath.Join(dir, "present.go"), filepath.Join(dir, "missing.go")
+	writeFile(t, present, 10)
+
+	m := Model{
+		cache:       newFileCache(maxCacheBytes),
+		missingOnly: true,
+		context: Context{
+			Name:         "t",
+			Files:        []string{present, missing},
+			YankedMtimes: map[string]time.Time{present: {}},
+		},
+	}
+	m.refreshFiles()
+	if len(m.files) != 1 || m.changedCount() != 1 {
+		t.Fatalf("files = %d, changed = %d, want 1 and 1", len(m.files), m.changedCount())
+	}
+
+	m.recordYankMtimes("t", "", map[string]time.Time{present: time.Now()})
+	if n := m.changedCount(); n != 0 {
+		t.Errorf("changedCount() after yank = %d, want 0", n)
+	}
+
+	writeFile(t, missing, 10)
+	m.reloadCursorFile()
+	for _, f := range m.allFiles {
+		if f.Path == missing && !f.Exists {
+			t.Error("reloaded file still missing in allFiles")
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Session holds UI state restored between runs (~/.ctx/session.yaml)
+type Session struct {
+	ActiveTab mainTab `yaml:"active_tab"`
+	Cursor    int     `yaml:"cursor"`
+	ActiveBox int     `yaml:"active_box"`
+}
+
+// LoadSession loads the saved session from ~/.ctx/session.yaml
+func LoadSession() (Session, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return Session{}, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "session.yaml"))
+	if err != nil {
+		return Session{}, err
+	}
+
+	var s Session
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return Session{}, err
+	}
+
+	return s, nil
+}
+
+// SaveSession saves the session to ~/.ctx/session.yaml
+func SaveSession(s Session) error {
+	dir, err := ConfigDir()
+	if err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, "session.yaml"), data, 0600)
+}
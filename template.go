@@ -0,0 +1,137 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Template seeds a new context (~/.ctx/templates/*.yaml)
+type Template struct {
+	Name           string `yaml:"name"`
+	ProjectContext string `yaml:"project_context,omitempty"`
+	Request        string `yaml:"request,omitempty"`
+	ExcludeRule    string `yaml:"exclude_rule,omitempty"` // exclude rule for contexts created from the template
+}
+
+// blankTemplate is the template picker entry for an empty context
+const blankTemplate = "(blank)"
+
+// TemplateDir returns the path to ~/.ctx/templates/
+func TemplateDir() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "templates"), nil
+}
+
+// defaultTemplates are written the first time the templates directory is created
+var defaultTemplates = []Template{
+	{
+		Name: "bugfix",
+		Request: `Bug: <what goes wrong>
+
+Steps to reproduce:
+1.
+
+Expected:
+
+Actual:
+
+Find the cause in the files below and propose a minimal fix.
+`,
+	},
+	{
+		Name: "feature",
+		Request: `Feature: <what to add>
+
+Requirements:
+-
+
+Follow the existing conventions in the files below and list every file that needs to change.
+`,
+	},
+}
+
+// ensureTemplateDir creates ~/.ctx/templates/ with the example templates if it doesn't exist.
+// An existing directory is left alone, so deleted examples stay deleted.
+func ensureTemplateDir() error {
+	dir, err := TemplateDir()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for _, tmpl := range defaultTemplates {
+		data, err := yaml.Marshal(tmpl)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, tmpl.Name+".yaml"), data, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListTemplates returns the names of all templates in ~/.ctx/templates/, sorted
+func ListTemplates() ([]string, error) {
+	dir, err := TemplateDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".yaml") {
+			names = append(names, strings.TrimSuffix(e.Name(), ".yaml"))
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// LoadTemplate loads a template by name from ~/.ctx/templates/
+func LoadTemplate(name string) (Template, error) {
+	dir, err := TemplateDir()
+	if err != nil {
+		return Template{}, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, name+".yaml"))
+	if err != nil {
+		return Template{}, err
+	}
+
+	var tmpl Template
+	if err := yaml.Unmarshal(data, &tmpl); err != nil {
+		return Template{}, err
+	}
+
+	return tmpl, nil
+}
+
+// Apply copies the template's text and exclude rule into ctx
+func (tmpl Template) Apply(ctx *Context) {
+	ctx.ProjectContext = tmpl.ProjectContext
+	ctx.Request = tmpl.Request
+	ctx.ExcludeRule = tmpl.ExcludeRule
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// benchModel returns a model with long Request/Project Context texts and files
+// that don't exist on disk, sized like a large terminal
+func benchModel(boxes *boxCache) Model {
+	m := Model{
+		mode:        modeNormal,
+		width:       240,
+		height:      70,
+		editingBox:  -1,
+		historyBase: -1,
+		cache:       newFileCache(maxCacheBytes),
+		boxes:       boxes,
+		context: Context{
+			Name:           "bench",
+			Request:        strings.Repeat("Refactor the handler so that errors are surfaced to the caller.\n", 40),
+			ProjectContext: strings.Repeat("A Go service with a Bubble Tea front end and YAML storage.\n", 40),
+		},
+	}
+	for i := range 200 {
+		path := fmt.Sprintf("/nonexistent/project/pkg%d/file%d.go", i%10, i)
+		m.context.Files = append(m.context.Files, path)
+		m.files = append(m.files, FileInfo{Path: path, Project: "project", RelPath: path[len("/nonexistent/project/"):], Size: int64(i * 100), Exists: true})
+	}
+	m.allFiles = m.files
+	return m
+}
+
+// BenchmarkViewContextTab redraws the context tab while moving the cursor, with
+// and without the rendered box cache
+func BenchmarkViewContextTab(b *testing.B) {
+	for _, bc := range []struct {
+		name  string
+		boxes *boxCache
+	}{
+		{"uncached", nil},
+		{"cached", newBoxCache()},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			m := benchModel(bc.boxes)
+			m.activeBox = boxFiles
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				m.cursor = i % len(m.files)
+				_ = m.viewContextTab()
+			}
+		})
+	}
+}
+
+func TestCreateBorderedBoxCached(t *testing.T) {
+	uncached := benchModel(nil)
+	cached := benchModel(newBoxCache())
+
+	for _, active := range []bool{false, true, false} {
+		want := uncached.createBorderedBox("Request", uncached.context.Request, 100, 20, active)
+		if got := cached.createBorderedBox("Request", cached.context.Request, 100, 20, active); got != want {
+			t.Fatalf("cached box (active=%v) differs from a fresh render", active)
+		}
+	}
+
+	// Editing the text must not return the old box
+	cached.context.Request = "changed"
+	want := uncached.createBorderedBox("Request", "changed", 100, 20, false)
+	if got := cached.createBorderedBox("Request", cached.context.Request, 100, 20, false); got != want {
+		t.Fatal("changed content returned a stale box")
+	}
+}
+
+func TestTruncateWidth(t *testing.T) {
+	for _, tc := range []struct {
+		in    string
+		width int
+		want  string
+	}{
+		{"héllo wörld", 4, "héll"},
+		{"日本語", 3, "日"}, // wide characters take two cells
+		{"short", 10, "short"},
+	} {
+		if got := truncateWidth(tc.in, tc.width); got != tc.want {
+			t.Errorf("truncateWidth(%q, %d) = %q, want %q", tc.in, tc.width, got, tc.want)
+		}
+	}
+}